@@ -54,10 +54,11 @@ func (s Server) Generate() *grpc.Server {
 
 func (s Server) serverInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (data interface{}, err error) {
 	requestTime := time.Now()
+	log := s.log.With("method", info.FullMethod)
 	defer func() {
 		if e := recover(); e != nil {
 			tracks := Tracks()
-			s.log.With("track_list", tracks).Error(e)
+			log.With("track_list", tracks).Error(e)
 			err = fmt.Errorf("panic: %v", e)
 		}
 		st := "SUCCESS"
@@ -66,9 +67,12 @@ func (s Server) serverInterceptor(ctx context.Context, req interface{}, info *gr
 			st = "FAILED"
 			e = fmt.Sprintf("error: %s", err.Error())
 		}
-		s.log.Info(fmt.Sprintf("[%s] [%s] [%s] %s", st, time.Now().Sub(requestTime), info.FullMethod, e))
+		log.Info(fmt.Sprintf("[%s] [%s] [%s] %s", st, time.Now().Sub(requestTime), info.FullMethod, e))
 	}()
 	appID, appKey := s.getAuthInfo(ctx)
+	log = log.With("app_id", appID)
+	// 处理函数通过 logger.FromContext(ctx) 获取带请求信息的 logger
+	ctx = logger.WithContext(ctx, log)
 	if s.preprocess != nil {
 		if ctx, err = s.preprocess(appID, appKey, ctx); err != nil {
 			return
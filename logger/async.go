@@ -0,0 +1,200 @@
+package logger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// FullPolicy 异步写入队列满时的处理方式
+type FullPolicy int
+
+const (
+	// FullBlock 阻塞直到队列有空位
+	FullBlock FullPolicy = iota
+	// FullDrop 直接丢弃
+	FullDrop
+	// FullDropCount 丢弃并计数, 每个 flush 周期以 Warn 级别记录一次丢弃条数
+	FullDropCount
+)
+
+// async 异步写入配置, 由 With/Kind 派生的 Logger 共享
+type async struct {
+	// dropped 放在首位保证 32 位平台上原子操作对齐
+	dropped  uint64
+	size     int
+	interval time.Duration
+	policy   FullPolicy
+	// root NewLogger 返回的 Logger, 丢弃计数不带派生 Logger 的字段
+	root *Logger
+}
+
+// 异步写入的默认队列长度和写入间隔
+const (
+	defaultAsyncSize     = 1024
+	defaultFlushInterval = time.Second
+)
+
+// WithAsync 日志文件改为异步写入, size 为队列长度, 每隔 flushInterval 写入文件一次, Sync/Close 时写入全部缓冲的日志;
+// size/flushInterval 不大于 0 时使用默认值 1024/1s
+func WithAsync(size int, flushInterval time.Duration, policy FullPolicy) Option {
+	if size <= 0 {
+		size = defaultAsyncSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	return func(l *Logger) {
+		l.async = &async{size: size, interval: flushInterval, policy: policy}
+	}
+}
+
+type asyncEntry struct {
+	data    []byte
+	flushed chan error
+}
+
+// asyncWriter 由后台协程批量写入 fileWriter
+type asyncWriter struct {
+	l      *Logger
+	out    *fileWriter
+	queue  chan asyncEntry
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+	// dropped 交给 reporter 协程记录, 避免后台协程写入自身的队列
+	dropped chan uint64
+}
+
+func newAsyncWriter(l *Logger, out *fileWriter) *asyncWriter {
+	w := &asyncWriter{
+		l:     l,
+		out:   out,
+		queue: make(chan asyncEntry, l.async.size),
+		done:  make(chan struct{}),
+	}
+	if l.async.policy == FullDropCount {
+		w.dropped = make(chan uint64, 1)
+		go w.reporter()
+	}
+	go w.run()
+	return w
+}
+
+// asyncBatchSize 缓冲的日志达到该大小时立即写入文件
+const asyncBatchSize = 32 * 1024
+
+// run 按条目缓冲, 保证每条日志完整交给 fileWriter, 切割只发生在条目之间
+func (w *asyncWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.l.async.interval)
+	defer ticker.Stop()
+	var entries [][]byte
+	var size int
+	flush := func() error {
+		if len(entries) == 0 {
+			return nil
+		}
+		err := w.out.writeEntries(entries)
+		if err != nil {
+			printf("write log file err: %v", err)
+		}
+		entries, size = entries[:0], 0
+		return err
+	}
+	for {
+		select {
+		case e, ok := <-w.queue:
+			if !ok {
+				flush()
+				return
+			}
+			if e.flushed != nil {
+				e.flushed <- flush()
+				continue
+			}
+			entries = append(entries, e.data)
+			if size += len(e.data); size >= asyncBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			w.report()
+		}
+	}
+}
+
+// report 上一次的计数尚未记录时合并到下一个周期
+func (w *asyncWriter) report() {
+	if w.dropped == nil {
+		return
+	}
+	if n := atomic.SwapUint64(&w.l.async.dropped, 0); n > 0 {
+		select {
+		case w.dropped <- n:
+		default:
+			atomic.AddUint64(&w.l.async.dropped, n)
+		}
+	}
+}
+
+func (w *asyncWriter) reporter() {
+	for n := range w.dropped {
+		w.l.async.root.write(WarnLevel, "log entries dropped by async buffer", zapcore.EntryCaller{}, Int64("dropped", int64(n)))
+	}
+}
+
+// Write zap 会复用 p, 入队前需要复制
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return w.out.Write(p)
+	}
+	e := asyncEntry{data: append([]byte(nil), p...)}
+	if w.l.async.policy == FullBlock {
+		w.queue <- e
+		return len(p), nil
+	}
+	select {
+	case w.queue <- e:
+	default:
+		if w.l.async.policy == FullDropCount {
+			atomic.AddUint64(&w.l.async.dropped, 1)
+		}
+	}
+	return len(p), nil
+}
+
+// Sync 等待队列中已有的日志写入文件
+func (w *asyncWriter) Sync() error {
+	w.mu.RLock()
+	if !w.closed {
+		e := asyncEntry{flushed: make(chan error, 1)}
+		w.queue <- e
+		if err := <-e.flushed; err != nil {
+			w.mu.RUnlock()
+			return err
+		}
+	}
+	w.mu.RUnlock()
+	return w.out.Sync()
+}
+
+func (w *asyncWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.queue)
+	w.mu.Unlock()
+	<-w.done
+	if w.dropped != nil {
+		close(w.dropped)
+	}
+	return w.out.Close()
+}
@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"context"
+	"sync"
+)
+
+type ctxKey struct{}
+
+type contextKey struct {
+	name string
+	key  interface{}
+}
+
+var (
+	contextKeysMu sync.RWMutex
+	contextKeys   []contextKey
+)
+
+// RegisterContextKey Ctx 会将 ctx.Value(key) 以 name 为字段名加入日志, 一般在 init 中调用
+func RegisterContextKey(name string, key interface{}) {
+	contextKeysMu.Lock()
+	defer contextKeysMu.Unlock()
+	for i, k := range contextKeys {
+		if k.name == name {
+			contextKeys[i].key = key
+			return
+		}
+	}
+	contextKeys = append(contextKeys, contextKey{name: name, key: key})
+}
+
+// ContextFields 返回 ctx 中已注册 key 对应的字段, 供 Interface 的其他实现使用
+func ContextFields(ctx context.Context) []Field {
+	contextKeysMu.RLock()
+	defer contextKeysMu.RUnlock()
+	var fields []Field
+	for _, k := range contextKeys {
+		if v := ctx.Value(k.key); v != nil {
+			fields = append(fields, Any(k.name, v))
+		}
+	}
+	return fields
+}
+
+// WithContext 将 l 放入 ctx
+func WithContext(ctx context.Context, l Interface) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext 返回 ctx 中的 Logger 并加入已注册 key 的字段, 没有时返回 NewNop()
+func FromContext(ctx context.Context) Interface {
+	l, ok := ctx.Value(ctxKey{}).(Interface)
+	if !ok {
+		return NewNop()
+	}
+	return l.Ctx(ctx)
+}
+
+// Ctx 返回加入 ctx 中已注册 key 字段的 Logger
+func (l *Logger) Ctx(ctx context.Context) Interface {
+	fields := ContextFields(ctx)
+	if len(fields) == 0 {
+		return l
+	}
+	n := l.clone()
+	n.fields = MergeFields(l.fields, fields)
+	return n
+}
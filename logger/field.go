@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Field 强类型字段, 可以和 key/value 混合传给 With, 避免反射
+type Field = zap.Field
+
+// badKey 非字符串的 key 或缺少 value 的 key 使用的字段名
+const badKey = "!BADKEY"
+
+func String(key, val string) Field {
+	return zap.String(key, val)
+}
+
+func Int(key string, val int) Field {
+	return zap.Int(key, val)
+}
+
+func Int64(key string, val int64) Field {
+	return zap.Int64(key, val)
+}
+
+func Bool(key string, val bool) Field {
+	return zap.Bool(key, val)
+}
+
+func Duration(key string, val time.Duration) Field {
+	return zap.Duration(key, val)
+}
+
+func Time(key string, val time.Time) Field {
+	return zap.Time(key, val)
+}
+
+// Err 字段名为 err
+func Err(err error) Field {
+	return zap.NamedError("err", err)
+}
+
+func Any(key string, val interface{}) Field {
+	return zap.Any(key, val)
+}
+
+// Fields 将 With 的参数转换为字段, 规则同 log/slog:
+// Field 直接使用, string 与其后的参数组成一个字段, 其他参数及末尾缺少 value 的 key 记为 !BADKEY
+func Fields(args ...interface{}) []Field {
+	fields := make([]Field, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		switch v := args[i].(type) {
+		case Field:
+			fields = append(fields, v)
+		case string:
+			if i+1 < len(args) {
+				fields = append(fields, zap.Any(v, args[i+1]))
+				i++
+			} else {
+				fields = append(fields, zap.String(badKey, v))
+			}
+		default:
+			fields = append(fields, zap.Any(badKey, v))
+		}
+	}
+	return fields
+}
+
+// MergeFields 同名字段原位替换, 新字段追加在末尾, 不修改 fields
+func MergeFields(fields []Field, add []Field) []Field {
+	merged := make([]Field, len(fields), len(fields)+len(add))
+	copy(merged, fields)
+	for _, f := range add {
+		replaced := false
+		for i := range merged {
+			if merged[i].Key == f.Key && f.Key != badKey {
+				merged[i] = f
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, f)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,31 @@
+package logger
+
+import (
+	"net/http"
+)
+
+// SetLevel 运行时修改最低日志级别, 对所有 With/Kind 派生的 Logger 生效
+func (l *Logger) SetLevel(level Level) {
+	l.level.SetLevel(level)
+}
+
+func (l *Logger) Level() Level {
+	return l.level.Level()
+}
+
+// LevelHandler GET 返回当前级别, PUT {"level":"debug"} 修改级别
+func (l *Logger) LevelHandler() http.Handler {
+	return l.level
+}
+
+// shiftLevel 调整级别, delta 为负时输出更多日志
+func (l *Logger) shiftLevel(delta int) Level {
+	level := l.level.Level() + Level(delta)
+	if level < DebugLevel {
+		level = DebugLevel
+	} else if level > FatalLevel {
+		level = FatalLevel
+	}
+	l.level.SetLevel(level)
+	return level
+}
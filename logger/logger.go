@@ -1,9 +1,9 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path"
 	"sync"
@@ -16,6 +16,8 @@ import (
 type Interface interface {
 	With(args ...interface{}) Interface
 	Kind(v string) Interface
+	// Ctx 加入 ctx 中已注册 key (见 RegisterContextKey) 的字段
+	Ctx(ctx context.Context) Interface
 	Debug(args ...interface{})
 	Info(args ...interface{})
 	Warn(args ...interface{})
@@ -33,16 +35,32 @@ type Interface interface {
 type Logger struct {
 	Dir         string
 	TimeFormat  string
-	args        map[interface{}]interface{}
+	fields      []Field
+	level       zap.AtomicLevel
+	rotation    *rotation
+	sampling    *sampling
+	async       *async
+	sinks       []sink
+	storeMu     *sync.Mutex
 	loggerStore *sync.Map
 }
 
-func NewLogger(dir, timeFormat string) *Logger {
+func NewLogger(dir, timeFormat string, options ...Option) *Logger {
 	l := new(Logger)
 	l.Dir = dir
 	l.TimeFormat = timeFormat
-	l.args = map[interface{}]interface{}{}
+	l.level = zap.NewAtomicLevelAt(zap.InfoLevel)
+	l.rotation = &rotation{}
+	l.sampling = &sampling{}
+	l.storeMu = &sync.Mutex{}
 	l.loggerStore = &sync.Map{}
+	for _, opt := range options {
+		opt(l)
+	}
+	if l.async != nil {
+		l.async.root = l
+	}
+	l.startSummary()
 	return l
 }
 
@@ -50,135 +68,229 @@ func (l *Logger) clone() *Logger {
 	n := new(Logger)
 	n.Dir = l.Dir
 	n.TimeFormat = l.TimeFormat
-	n.args = map[interface{}]interface{}{}
-	for k, v := range l.args {
-		n.args[k] = v
-	}
+	n.fields = l.fields
+	n.level = l.level
+	n.rotation = l.rotation
+	n.sampling = l.sampling
+	n.async = l.async
+	n.sinks = l.sinks
+	n.storeMu = l.storeMu
 	n.loggerStore = l.loggerStore
 	return n
 }
 
-func (l *Logger) clearArgs() *Logger {
-	l.args = map[interface{}]interface{}{}
-	return l
-}
-
+// With 参数为 key/value 对或 Field, 同名字段替换原有的值
 func (l *Logger) With(args ...interface{}) Interface {
 	n := l.clone()
-	var k interface{}
-	for i, v := range args {
-		if i%2 == 0 {
-			n.args[v] = nil
-			k = v
-		} else {
-			n.args[k] = v
-		}
-	}
+	n.fields = MergeFields(l.fields, Fields(args...))
 	return n
 }
 
-func (l *Logger) getArgs() []interface{} {
-	var data []interface{}
-	for i, v := range l.args {
-		data = append(data, i, v)
-	}
-	return data
-}
-
 func (l *Logger) Kind(v string) Interface {
-	return l.clone().clearArgs().With("kind", v)
+	n := l.clone()
+	n.fields = []Field{String("kind", v)}
+	return n
 }
 
 // Debug uses fmt.Sprint to construct and log a message.
 func (l *Logger) Debug(args ...interface{}) {
-	l.getZapLogger().With(l.getArgs()...).Debug(args...)
+	l.log(DebugLevel, "", args)
 }
 
 func (l *Logger) Debugf(template string, args ...interface{}) {
-	l.getZapLogger().With(l.getArgs()...).Debugf(template, args...)
+	l.log(DebugLevel, template, args)
 }
 
 // Info uses fmt.Sprint to construct and log a message.
 func (l *Logger) Info(args ...interface{}) {
-	l.getZapLogger().With(l.getArgs()...).Info(args...)
+	l.log(InfoLevel, "", args)
 }
 
 func (l *Logger) Infof(template string, args ...interface{}) {
-	l.getZapLogger().With(l.getArgs()...).Infof(template, args...)
+	l.log(InfoLevel, template, args)
 }
 
 // Warn uses fmt.Sprint to construct and log a message.
 func (l *Logger) Warn(args ...interface{}) {
-	l.getZapLogger().With(l.getArgs()...).Warn(args...)
+	l.log(WarnLevel, "", args)
 }
 
 func (l *Logger) Warnf(template string, args ...interface{}) {
-	l.getZapLogger().With(l.getArgs()...).Warnf(template, args...)
+	l.log(WarnLevel, template, args)
 }
 
 // Error uses fmt.Sprint to construct and log a message.
 func (l *Logger) Error(args ...interface{}) {
-	l.getZapLogger().With(l.getArgs()...).Error(args...)
+	l.log(ErrorLevel, "", args)
 }
 
 func (l *Logger) Errorf(template string, args ...interface{}) {
-	l.getZapLogger().With(l.getArgs()...).Errorf(template, args...)
+	l.log(ErrorLevel, template, args)
 }
 
 // Panic uses fmt.Sprint to construct and log a message, then panics.
 func (l *Logger) Panic(args ...interface{}) {
-	l.getZapLogger().With(l.getArgs()...).Panic(args...)
+	l.log(PanicLevel, "", args)
 }
 
 func (l *Logger) Panicf(template string, args ...interface{}) {
-	l.getZapLogger().With(l.getArgs()...).Panicf(template, args...)
+	l.log(PanicLevel, template, args)
 }
 
 // Fatal uses fmt.Sprint to construct and log a message, then calls os.Exit.
 func (l *Logger) Fatal(args ...interface{}) {
-	l.getZapLogger().With(l.getArgs()...).Fatal(args...)
+	l.log(FatalLevel, "", args)
 }
 
 func (l *Logger) Fatalf(template string, args ...interface{}) {
-	l.getZapLogger().With(l.getArgs()...).Fatalf(template, args...)
+	l.log(FatalLevel, template, args)
+}
+
+// log 级别未开启时不格式化消息, Panic/Fatal 总是执行
+func (l *Logger) log(level Level, template string, args []interface{}) {
+	zl := l.getZapLogger()
+	if level < PanicLevel && !zl.Core().Enabled(level) {
+		return
+	}
+	if ce := zl.Check(level, message(template, args)); ce != nil {
+		ce.Write(l.fields...)
+	}
+}
+
+// write 以 caller 代替实际调用位置记录, caller 未定义时不输出 caller
+func (l *Logger) write(level Level, msg string, caller zapcore.EntryCaller, fields ...Field) {
+	if ce := l.getZapLogger().Check(level, msg); ce != nil {
+		ce.Caller = caller
+		ce.Write(MergeFields(l.fields, fields)...)
+	}
+}
+
+func message(template string, args []interface{}) string {
+	if template != "" {
+		return fmt.Sprintf(template, args...)
+	}
+	if len(args) == 1 {
+		if s, ok := args[0].(string); ok {
+			return s
+		}
+	}
+	return fmt.Sprint(args...)
+}
+
+type fileOutput interface {
+	io.Writer
+	Sync() error
+	Close() error
+}
+
+// bucket 一个时间段对应的 zap logger 及其输出
+type bucket struct {
+	logger *zap.Logger
+	writer io.Writer
+	// file 输出到标准输出/错误时为 nil
+	file  fileOutput
+	sinks []zapcore.WriteSyncer
+}
+
+// sync 标准输出/错误不支持 Sync, 只返回日志文件的错误
+func (b *bucket) sync() error {
+	for _, s := range b.sinks {
+		s.Sync()
+	}
+	if b.file != nil {
+		return b.file.Sync()
+	}
+	return nil
+}
+
+func (b *bucket) close() error {
+	err := b.sync()
+	if b.file != nil {
+		if closeErr := b.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (l *Logger) getZapLogger() *zap.Logger {
+	return l.getBucket().logger
 }
 
-func (l *Logger) getZapLogger() *zap.SugaredLogger {
+// getBucket 切换时间段时关闭旧的 bucket 后再清理旧文件
+func (l *Logger) getBucket() *bucket {
 	timeFile := time.Now().Format(l.TimeFormat)
 	if v, ok := l.loggerStore.Load(timeFile); ok {
-		return v.(*zap.SugaredLogger)
+		return v.(*bucket)
+	}
+	l.storeMu.Lock()
+	defer l.storeMu.Unlock()
+	if v, ok := l.loggerStore.Load(timeFile); ok {
+		return v.(*bucket)
 	}
-	actual, ok := l.loggerStore.LoadOrStore(timeFile, func() *zap.SugaredLogger {
-		filename := fmt.Sprintf("%s/%s.log", l.Dir, timeFile)
-		encodingCfg := zap.NewProductionEncoderConfig()
-		encodingCfg.EncodeTime = func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
-			enc.AppendString(t.Format("2006-01-02T15:04:05.000Z"))
+	filename := fmt.Sprintf("%s/%s.log", l.Dir, timeFile)
+	b := l.newBucket(filename)
+	l.loggerStore.Range(func(key, value interface{}) bool {
+		l.loggerStore.Delete(key)
+		if err := value.(*bucket).close(); err != nil {
+			printf("close log file err: %v", err)
 		}
-		core := zapcore.NewTee(
-			zapcore.NewCore(
-				zapcore.NewJSONEncoder(encodingCfg),
-				zapcore.AddSync(l.getWriter(filename)),
-				zap.NewAtomicLevelAt(zap.InfoLevel),
-			),
-		)
-		zapLogger := zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1))
-		return zapLogger.Sugar()
-	}())
-	if !ok {
-		l.loggerStore.Range(func(key, value interface{}) bool {
-			if key != timeFile {
-				l.loggerStore.Delete(key)
-			}
-			return true
-		})
+		return true
+	})
+	l.loggerStore.Store(timeFile, b)
+	if b.file != nil {
+		l.cleanup(filename)
 	}
+	return b
+}
+
+func (l *Logger) newBucket(filename string) *bucket {
+	b := &bucket{writer: l.getWriter(filename)}
+	if w, ok := b.writer.(*fileWriter); ok {
+		b.file = w
+		if l.async != nil {
+			b.file = newAsyncWriter(l, w)
+			b.writer = b.file
+		}
+	}
+	cores := []zapcore.Core{
+		l.newCore(sink{encoding: JSONEncoding, level: DebugLevel, writer: zapcore.AddSync(b.writer)}),
+	}
+	for _, s := range l.sinks {
+		cores = append(cores, l.newCore(s))
+		b.sinks = append(b.sinks, s.writer)
+	}
+	b.logger = zap.New(l.sampling.wrap(zapcore.NewTee(cores...)), zap.AddCaller(), zap.AddCallerSkip(2))
+	return b
+}
+
+// Sync 将缓冲的日志写入文件
+func (l *Logger) Sync() (err error) {
 	l.loggerStore.Range(func(key, value interface{}) bool {
+		if syncErr := value.(*bucket).sync(); err == nil {
+			err = syncErr
+		}
 		return true
 	})
-	return actual.(*zap.SugaredLogger)
+	return
+}
+
+// Close 写入缓冲的日志并关闭打开的文件, 服务退出前调用, 之后再记录日志会重新打开文件, 但不再输出采样汇总
+func (l *Logger) Close() (err error) {
+	l.stopSummary()
+	l.storeMu.Lock()
+	defer l.storeMu.Unlock()
+	l.loggerStore.Range(func(key, value interface{}) bool {
+		l.loggerStore.Delete(key)
+		if closeErr := value.(*bucket).close(); err == nil {
+			err = closeErr
+		}
+		return true
+	})
+	return
 }
 
-func (l Logger) getWriter(filename string) (w io.Writer) {
+func (l *Logger) getWriter(filename string) (w io.Writer) {
 	w = os.Stderr
 	dir := path.Dir(filename)
 	if dir == "/dev/stderr" {
@@ -187,11 +299,11 @@ func (l Logger) getWriter(filename string) (w io.Writer) {
 		return os.Stdout
 	}
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		log.Printf("create log file err: %v", err)
+		printf("create log file err: %v", err)
 		return
 	}
-	if file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
-		log.Printf("create log file err: %v", err)
+	if file, err := newFileWriter(l, filename); err != nil {
+		printf("create log file err: %v", err)
 		return
 	} else {
 		w = file
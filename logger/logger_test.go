@@ -1,11 +1,34 @@
 package logger
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
 
+// activeFile 返回 l 当前写入的日志文件
+func activeFile(t *testing.T, l *Logger) string {
+	t.Helper()
+	switch f := l.getBucket().file.(type) {
+	case *fileWriter:
+		return f.filename
+	case *asyncWriter:
+		return f.out.filename
+	}
+	t.Fatal("no active log file")
+	return ""
+}
+
 func TestLogger_Info(t *testing.T) {
 	l := NewLogger(".", "20060102150405")
 	for {
@@ -27,3 +50,393 @@ func TestLogW(t *testing.T) {
 	l := NewLogger(".", "20060102150405")
 	l.With("a", 1).Info("aaa")
 }
+
+func TestLogger_SetLevel(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLogger(dir, "20060102", WithLevel(WarnLevel))
+	child := l.With("a", 1)
+	child.Info("dropped")
+	l.SetLevel(DebugLevel)
+	child.Debug("kept")
+	raw, err := os.ReadFile(activeFile(t, l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "dropped") || !strings.Contains(string(raw), "kept") {
+		t.Fatalf("unexpected log content: %s", raw)
+	}
+}
+
+func TestLogger_LevelHandler(t *testing.T) {
+	l := NewLogger(t.TempDir(), "20060102")
+	h := l.LevelHandler()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/level", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"level":"info"`) {
+		t.Fatalf("unexpected GET response: %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/level", strings.NewReader(`{"level":"debug"}`)))
+	if rec.Code != http.StatusOK || l.Level() != DebugLevel {
+		t.Fatalf("unexpected PUT response: %d %s, level %s", rec.Code, rec.Body, l.Level())
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/level", strings.NewReader(`{"level":"verbose"}`)))
+	if rec.Code != http.StatusBadRequest || l.Level() != DebugLevel {
+		t.Fatalf("expect invalid level rejected: %d %s, level %s", rec.Code, rec.Body, l.Level())
+	}
+}
+
+func TestLogger_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLogger(dir, "20060102", WithMaxSize(200), WithMaxBackups(2), WithCompress(true))
+	for i := 0; i < 10; i++ {
+		l.Info(strings.Repeat("x", 100))
+	}
+	filename := activeFile(t, l)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		var gz int
+		for _, name := range names {
+			if strings.HasSuffix(name, ".log.gz") {
+				gz++
+			}
+		}
+		if len(names) == 3 && gz == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected files: %v", names)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(filename); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogger_RotateFailed(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLogger(dir, "20060102", WithMaxSize(200))
+	defer l.Close()
+	l.Info(strings.Repeat("x", 100))
+	filename := activeFile(t, l)
+	// 当前文件被删除后切割时 rename 失败, 重新打开原文件继续写入
+	os.Remove(filename)
+	l.Info("after rename failed")
+	l.Info("still writable")
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, _ := os.ReadFile(strings.TrimSuffix(filename, ".log") + ".1.log")
+	raw = append(backup, raw...)
+	if !strings.Contains(string(raw), "after rename failed") || !strings.Contains(string(raw), "still writable") {
+		t.Fatalf("unexpected log content: %s", raw)
+	}
+}
+
+func TestLogger_RotateClosed(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLogger(dir, "20060102")
+	defer l.Close()
+	// 已关闭的旧文件不会被重新创建, 写入转到当前文件
+	old := dir + "/20000101.log"
+	w, err := newFileWriter(l, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	os.Remove(old)
+	if _, err := w.Write([]byte("late\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatalf("expect %s not recreated, got %v", old, err)
+	}
+	raw, err := os.ReadFile(activeFile(t, l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), "late") {
+		t.Fatalf("expect late write in current file: %s", raw)
+	}
+
+	// 不覆盖已存在的压缩文件
+	os.WriteFile(old, []byte("new"), 0644)
+	os.WriteFile(old+".gz", []byte("keep"), 0644)
+	if err := compressFile(old); err == nil {
+		t.Fatal("expect error when gz exists")
+	}
+	if raw, _ := os.ReadFile(old + ".gz"); string(raw) != "keep" {
+		t.Fatalf("expect gz kept, got %q", raw)
+	}
+	if _, err := os.Stat(old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogger_Close(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLogger(dir, "20060102")
+	l.Info("before")
+	if err := l.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	l.loggerStore.Range(func(key, value interface{}) bool {
+		n++
+		return true
+	})
+	if n != 0 {
+		t.Fatalf("expect no open bucket, got %d", n)
+	}
+	l.Info("after")
+	raw, err := os.ReadFile(activeFile(t, l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), "before") || !strings.Contains(string(raw), "after") {
+		t.Fatalf("unexpected log content: %s", raw)
+	}
+	l.Close()
+}
+
+func TestLogger_WithSink(t *testing.T) {
+	dir := t.TempDir()
+	buf := &bytes.Buffer{}
+	l := NewLogger(dir, "20060102", WithSink(ConsoleEncoding, WarnLevel, buf))
+	l.Info("info message")
+	l.With("a", 1).Warn("warn message")
+	if strings.Contains(buf.String(), "info message") || !strings.Contains(buf.String(), "warn message") {
+		t.Fatalf("unexpected console content: %s", buf)
+	}
+	raw, err := os.ReadFile(activeFile(t, l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), "info message") || !strings.Contains(string(raw), "warn message") {
+		t.Fatalf("unexpected log content: %s", raw)
+	}
+	l.SetLevel(ErrorLevel)
+	l.Warn("dropped")
+	if strings.Contains(buf.String(), "dropped") {
+		t.Fatalf("unexpected console content: %s", buf)
+	}
+	l.Close()
+}
+
+type requestIDKey struct{}
+
+func TestLogger_Ctx(t *testing.T) {
+	RegisterContextKey("request_id", requestIDKey{})
+	if _, ok := FromContext(context.Background()).(nopLogger); !ok {
+		t.Fatal("expect nop logger without logger in context")
+	}
+	dir := t.TempDir()
+	l := NewLogger(dir, "20060102")
+	ctx := WithContext(context.Background(), l.With("a", 1))
+	ctx = context.WithValue(ctx, requestIDKey{}, "req-1")
+	FromContext(ctx).Info("from context")
+	l.Ctx(context.Background()).Info("without key")
+	raw, err := os.ReadFile(activeFile(t, l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"request_id":"req-1"`) || !strings.Contains(lines[0], `"a":1`) ||
+		strings.Contains(lines[1], "request_id") {
+		t.Fatalf("unexpected log content: %s", raw)
+	}
+	l.Close()
+}
+
+func TestLogger_WithFields(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLogger(dir, "20060102")
+	l.With("b", 1, "a", 2).With(Int("b", 3), 10, String("c", "x"), "dangling").Info("fields")
+	l.With(Err(fmt.Errorf("boom")), Duration("cost", time.Second)).Errorf("n=%d", 1)
+	raw, err := os.ReadFile(activeFile(t, l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected log content: %s", raw)
+	}
+	want := `"b":3,"a":2,"!BADKEY":10,"c":"x","!BADKEY":"dangling"}`
+	if !strings.HasSuffix(lines[0], want) || !strings.Contains(lines[0], `"caller":"logger/logger_test.go:`) {
+		t.Fatalf("unexpected log line: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"msg":"n=1"`) || !strings.Contains(lines[1], `"err":"boom","cost":1`) {
+		t.Fatalf("unexpected log line: %s", lines[1])
+	}
+	l.Close()
+}
+
+func TestLogger_Sampling(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLogger(dir, "20060102", WithSampling(time.Minute, 2, 3), WithSamplingSummary(50*time.Millisecond))
+	for i := 0; i < 10; i++ {
+		l.Error("storm")
+	}
+	time.Sleep(200 * time.Millisecond)
+	filename := activeFile(t, l)
+	l.Close()
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 前 2 条, 之后第 5/8 条
+	if n := strings.Count(string(raw), `"msg":"storm"`); n != 4 {
+		t.Fatalf("expect 4 sampled lines, got %d: %s", n, raw)
+	}
+	if !strings.Contains(string(raw), `"dropped":6`) {
+		t.Fatalf("expect dropped summary: %s", raw)
+	}
+}
+
+func TestLogger_Async(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLogger(dir, "20060102", WithAsync(16, time.Hour, FullBlock))
+	for i := 0; i < 100; i++ {
+		l.With("i", i).Info("async")
+	}
+	if err := l.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	filename := activeFile(t, l)
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(raw), `"msg":"async"`); n != 100 {
+		t.Fatalf("expect 100 lines after Sync, got %d", n)
+	}
+	l.Info("last")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if raw, err = os.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), `"msg":"last"`) {
+		t.Fatalf("expect last line after Close: %s", raw)
+	}
+
+	// 非正数使用默认值
+	l = NewLogger(t.TempDir(), "20060102", WithAsync(0, 0, FullDrop))
+	l.Info("default")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogger_AsyncRotate(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLogger(dir, "20060102", WithMaxSize(4096), WithAsync(1024, time.Hour, FullBlock))
+	for i := 0; i < 300; i++ {
+		l.With("i", i).Info(strings.Repeat("x", 300))
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for _, e := range entries {
+		raw, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(raw) > 4096 {
+			t.Fatalf("%s exceeds max size: %d", e.Name(), len(raw))
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+			if !json.Valid([]byte(line)) {
+				t.Fatalf("%s has broken line: %s", e.Name(), line)
+			}
+			n++
+		}
+	}
+	if n != 300 {
+		t.Fatalf("expect 300 lines, got %d", n)
+	}
+}
+
+func TestLogger_AsyncDropped(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLogger(dir, "20060102", WithAsync(4, 10*time.Millisecond, FullDropCount))
+	defer l.Close()
+	l.With("req", "x").Info("first")
+	// 锁住文件使后台协程阻塞在写入, 队列写满后丢弃
+	out := l.getBucket().file.(*asyncWriter).out
+	out.mu.Lock()
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 20; i++ {
+		l.With("req", "x").Info("flood")
+	}
+	out.mu.Unlock()
+	filename := activeFile(t, l)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		raw, _ := os.ReadFile(filename)
+		if i := strings.Index(string(raw), `"dropped":16`); i >= 0 {
+			line := string(raw)[strings.LastIndex(string(raw[:i]), "\n")+1:]
+			if strings.Contains(line, `"req"`) || strings.Contains(line, `"caller"`) {
+				t.Fatalf("unexpected dropped report: %s", line)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect dropped report: %s", raw)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLogger_Slog(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLogger(dir, "20060102")
+	slog.New(NewSlogHandler(l)).With("a", 1).WithGroup("g").Info("from slog", "b", 2)
+	slog.New(NewSlogHandler(l)).Debug("dropped")
+	restore := RedirectStdLog(l.Kind("std"), WarnLevel)
+	log.Printf("from std %d", 1)
+	restore()
+	raw, err := os.ReadFile(activeFile(t, l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"msg":"from slog","a":1,"g.b":2`) ||
+		!strings.Contains(lines[1], `"level":"warn"`) || !strings.Contains(lines[1], `"msg":"from std 1","kind":"std"`) {
+		t.Fatalf("unexpected log content: %s", raw)
+	}
+	// caller 为调用 slog/log 的位置
+	for _, line := range lines {
+		if !strings.Contains(line, `"caller":"logger/logger_test.go:`) {
+			t.Fatalf("expect caller in test file: %s", line)
+		}
+	}
+	l.Close()
+
+	buf := &bytes.Buffer{}
+	FromSlog(slog.NewJSONHandler(buf, nil)).With("a", 1).Kind("k").With(Int("b", 2)).Warnf("n=%d", 3)
+	out := buf.String()
+	if !strings.Contains(out, `"level":"WARN","msg":"n=3","kind":"k","b":2`) {
+		t.Fatalf("unexpected slog output: %s", out)
+	}
+}
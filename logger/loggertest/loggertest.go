@@ -0,0 +1,185 @@
+// Package loggertest 提供用于测试的 logger.Interface 实现
+package loggertest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lfun125/gotool/logger"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewNop 不关心日志时使用
+func NewNop() logger.Interface {
+	return logger.NewNop()
+}
+
+// Entry 一条记录的日志
+type Entry struct {
+	Level   logger.Level
+	Message string
+	// Kind 通过 Kind 设置的值, 不出现在 Fields 中
+	Kind   string
+	Fields []logger.Field
+}
+
+// Map 以字段名为 key 返回字段的值, 值的类型与 JSON 编码前一致 (如 Int 为 int64)
+func (e Entry) Map() map[string]interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range e.Fields {
+		f.AddTo(enc)
+	}
+	return enc.Fields
+}
+
+// Has 是否包含 key 且值按 fmt.Sprint 比较相等
+func (e Entry) Has(key string, value interface{}) bool {
+	v, ok := e.Map()[key]
+	return ok && fmt.Sprint(v) == fmt.Sprint(value)
+}
+
+type store struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+var _ logger.Interface = (*Recorder)(nil)
+
+// Recorder 将日志记录在内存中, With/Kind/Ctx 派生的 Recorder 共享记录
+type Recorder struct {
+	store  *store
+	kind   string
+	fields []logger.Field
+}
+
+func New() *Recorder {
+	return &Recorder{store: &store{}}
+}
+
+func (r *Recorder) clone() *Recorder {
+	return &Recorder{store: r.store, kind: r.kind, fields: r.fields}
+}
+
+func (r *Recorder) With(args ...interface{}) logger.Interface {
+	n := r.clone()
+	n.fields = logger.MergeFields(r.fields, logger.Fields(args...))
+	return n
+}
+
+func (r *Recorder) Kind(v string) logger.Interface {
+	return &Recorder{store: r.store, kind: v}
+}
+
+func (r *Recorder) Ctx(ctx context.Context) logger.Interface {
+	n := r.clone()
+	n.fields = logger.MergeFields(r.fields, logger.ContextFields(ctx))
+	return n
+}
+
+func (r *Recorder) record(level logger.Level, msg string) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	r.store.entries = append(r.store.entries, Entry{Level: level, Message: msg, Kind: r.kind, Fields: r.fields})
+}
+
+func (r *Recorder) Debug(args ...interface{}) { r.record(logger.DebugLevel, fmt.Sprint(args...)) }
+func (r *Recorder) Info(args ...interface{})  { r.record(logger.InfoLevel, fmt.Sprint(args...)) }
+func (r *Recorder) Warn(args ...interface{})  { r.record(logger.WarnLevel, fmt.Sprint(args...)) }
+func (r *Recorder) Error(args ...interface{}) { r.record(logger.ErrorLevel, fmt.Sprint(args...)) }
+
+// Panic 记录后 panic
+func (r *Recorder) Panic(args ...interface{}) {
+	msg := fmt.Sprint(args...)
+	r.record(logger.PanicLevel, msg)
+	panic(msg)
+}
+
+// Fatal 只记录, 不退出进程
+func (r *Recorder) Fatal(args ...interface{}) { r.record(logger.FatalLevel, fmt.Sprint(args...)) }
+
+func (r *Recorder) Debugf(template string, args ...interface{}) {
+	r.record(logger.DebugLevel, fmt.Sprintf(template, args...))
+}
+
+func (r *Recorder) Infof(template string, args ...interface{}) {
+	r.record(logger.InfoLevel, fmt.Sprintf(template, args...))
+}
+
+func (r *Recorder) Warnf(template string, args ...interface{}) {
+	r.record(logger.WarnLevel, fmt.Sprintf(template, args...))
+}
+
+func (r *Recorder) Errorf(template string, args ...interface{}) {
+	r.record(logger.ErrorLevel, fmt.Sprintf(template, args...))
+}
+
+func (r *Recorder) Panicf(template string, args ...interface{}) {
+	msg := fmt.Sprintf(template, args...)
+	r.record(logger.PanicLevel, msg)
+	panic(msg)
+}
+
+func (r *Recorder) Fatalf(template string, args ...interface{}) {
+	r.record(logger.FatalLevel, fmt.Sprintf(template, args...))
+}
+
+// Entries 返回全部记录的副本
+func (r *Recorder) Entries() []Entry {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return append([]Entry(nil), r.store.entries...)
+}
+
+func (r *Recorder) Reset() {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	r.store.entries = nil
+}
+
+// Filter 返回级别为 level, 消息包含 msg 且包含全部 key/value 的记录, msg 为空时不比较消息
+func (r *Recorder) Filter(level logger.Level, msg string, kv ...interface{}) []Entry {
+	var list []Entry
+	for _, e := range r.Entries() {
+		if e.Level != level || !strings.Contains(e.Message, msg) {
+			continue
+		}
+		match := true
+		for i := 0; i+1 < len(kv); i += 2 {
+			if !e.Has(fmt.Sprint(kv[i]), kv[i+1]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// AssertLogged 断言存在符合 Filter 条件的记录
+func (r *Recorder) AssertLogged(t testing.TB, level logger.Level, msg string, kv ...interface{}) {
+	t.Helper()
+	if len(r.Filter(level, msg, kv...)) == 0 {
+		t.Errorf("no %s entry with message %q and fields %v, got:\n%s", level, msg, kv, r.dump())
+	}
+}
+
+// AssertNotLogged 断言不存在符合 Filter 条件的记录
+func (r *Recorder) AssertNotLogged(t testing.TB, level logger.Level, msg string, kv ...interface{}) {
+	t.Helper()
+	if len(r.Filter(level, msg, kv...)) > 0 {
+		t.Errorf("unexpected %s entry with message %q and fields %v, got:\n%s", level, msg, kv, r.dump())
+	}
+}
+
+func (r *Recorder) dump() string {
+	var b strings.Builder
+	for _, e := range r.Entries() {
+		fmt.Fprintf(&b, "\t%s %q kind=%q %v\n", e.Level, e.Message, e.Kind, e.Map())
+	}
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package loggertest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lfun125/gotool/logger"
+)
+
+type traceKey struct{}
+
+func TestRecorder(t *testing.T) {
+	logger.RegisterContextKey("trace_id", traceKey{})
+	r := New()
+	var l logger.Interface = r
+	l.With("tube", "orders", "id", 1).With(logger.Err(errors.New("boom"))).Error("queue.Release")
+	l.Kind("cron").Infof("run %s", "cleanup")
+	ctx := context.WithValue(context.Background(), traceKey{}, "t-1")
+	logger.FromContext(logger.WithContext(ctx, l)).Warn("slow")
+
+	r.AssertLogged(t, logger.ErrorLevel, "Release", "tube", "orders", "id", 1, "err", "boom")
+	r.AssertLogged(t, logger.WarnLevel, "", "trace_id", "t-1")
+	r.AssertNotLogged(t, logger.InfoLevel, "queue")
+	entries := r.Entries()
+	if len(entries) != 3 || entries[1].Kind != "cron" || entries[1].Message != "run cleanup" || len(entries[1].Fields) != 0 {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	r.Reset()
+	if len(r.Entries()) != 0 {
+		t.Fatal("expect no entries after Reset")
+	}
+}
+
+func TestRecorder_Panic(t *testing.T) {
+	r := New()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expect panic")
+		}
+		r.AssertLogged(t, logger.PanicLevel, "bad")
+	}()
+	r.Panic("bad")
+}
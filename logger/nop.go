@@ -0,0 +1,30 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+type nopLogger struct{}
+
+// NewNop 返回丢弃所有日志的 Interface, Panic/Fatal 仍会 panic/退出
+func NewNop() Interface {
+	return nopLogger{}
+}
+
+func (n nopLogger) With(args ...interface{}) Interface        { return n }
+func (n nopLogger) Kind(v string) Interface                   { return n }
+func (n nopLogger) Ctx(ctx context.Context) Interface         { return n }
+func (nopLogger) Debug(args ...interface{})                   {}
+func (nopLogger) Info(args ...interface{})                    {}
+func (nopLogger) Warn(args ...interface{})                    {}
+func (nopLogger) Error(args ...interface{})                   {}
+func (nopLogger) Panic(args ...interface{})                   { panic(fmt.Sprint(args...)) }
+func (nopLogger) Fatal(args ...interface{})                   { os.Exit(1) }
+func (nopLogger) Debugf(template string, args ...interface{}) {}
+func (nopLogger) Infof(template string, args ...interface{})  {}
+func (nopLogger) Warnf(template string, args ...interface{})  {}
+func (nopLogger) Errorf(template string, args ...interface{}) {}
+func (nopLogger) Panicf(template string, args ...interface{}) { panic(fmt.Sprintf(template, args...)) }
+func (nopLogger) Fatalf(template string, args ...interface{}) { os.Exit(1) }
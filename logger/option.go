@@ -0,0 +1,55 @@
+package logger
+
+import (
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type Level = zapcore.Level
+
+const (
+	DebugLevel = zapcore.DebugLevel
+	InfoLevel  = zapcore.InfoLevel
+	WarnLevel  = zapcore.WarnLevel
+	ErrorLevel = zapcore.ErrorLevel
+	PanicLevel = zapcore.PanicLevel
+	FatalLevel = zapcore.FatalLevel
+)
+
+type Option func(l *Logger)
+
+// WithLevel 最低日志级别, 默认 InfoLevel
+func WithLevel(level Level) Option {
+	return func(l *Logger) {
+		l.level.SetLevel(level)
+	}
+}
+
+// WithMaxSize 单个日志文件的最大字节数, 超过后重命名为 <time>.<n>.log 并新建文件, 0 表示不限制
+func WithMaxSize(size int64) Option {
+	return func(l *Logger) {
+		l.rotation.maxSize = size
+	}
+}
+
+// WithMaxBackups 最多保留的历史日志文件数, 0 表示不限制
+func WithMaxBackups(n int) Option {
+	return func(l *Logger) {
+		l.rotation.maxBackups = n
+	}
+}
+
+// WithMaxAge 历史日志文件的最长保留时间, 0 表示不限制
+func WithMaxAge(d time.Duration) Option {
+	return func(l *Logger) {
+		l.rotation.maxAge = d
+	}
+}
+
+// WithCompress 后台将历史日志文件 gzip 压缩为 .log.gz
+func WithCompress(compress bool) Option {
+	return func(l *Logger) {
+		l.rotation.compress = compress
+	}
+}
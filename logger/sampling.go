@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// sampling 日志采样配置, 由 With/Kind 派生的 Logger 共享
+type sampling struct {
+	// dropped 放在首位保证 32 位平台上原子操作对齐
+	dropped    uint64
+	interval   time.Duration
+	first      int
+	thereafter int
+	summary    time.Duration
+	stopOnce   sync.Once
+	stop       chan struct{}
+}
+
+// WithSampling 每个 interval 内同一级别同一消息只记录前 first 条, 之后每 thereafter 条记录一条, thereafter 为 0 时全部丢弃
+func WithSampling(interval time.Duration, first, thereafter int) Option {
+	return func(l *Logger) {
+		l.sampling.interval = interval
+		l.sampling.first = first
+		l.sampling.thereafter = thereafter
+	}
+}
+
+// WithSamplingSummary 每隔 interval 以 Warn 级别记录一次期间因采样丢弃的日志条数
+func WithSamplingSummary(interval time.Duration) Option {
+	return func(l *Logger) {
+		l.sampling.summary = interval
+	}
+}
+
+func (s *sampling) wrap(core zapcore.Core) zapcore.Core {
+	if s.interval <= 0 {
+		return core
+	}
+	return zapcore.NewSamplerWithOptions(core, s.interval, s.first, s.thereafter,
+		zapcore.SamplerHook(func(_ zapcore.Entry, dec zapcore.SamplingDecision) {
+			if dec&zapcore.LogDropped != 0 {
+				atomic.AddUint64(&s.dropped, 1)
+			}
+		}),
+	)
+}
+
+// startSummary 启动汇总协程, Close 时停止
+func (l *Logger) startSummary() {
+	s := l.sampling
+	if s.interval <= 0 || s.summary <= 0 {
+		return
+	}
+	s.stop = make(chan struct{})
+	ticker := time.NewTicker(s.summary)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if n := atomic.SwapUint64(&s.dropped, 0); n > 0 {
+					l.With(Int64("dropped", int64(n)), Duration("interval", s.summary)).Warn("log entries dropped by sampling")
+				}
+			}
+		}
+	}()
+}
+
+func (l *Logger) stopSummary() {
+	s := l.sampling
+	if s.stop == nil {
+		return
+	}
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+
+package logger
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WatchLevelSignal 收到 SIGUSR1 时降低一级 (输出更多日志), 收到 SIGUSR2 时提高一级, 返回的函数用于停止
+func (l *Logger) WatchLevelSignal() (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-ch:
+				delta := 1
+				if sig == syscall.SIGUSR1 {
+					delta = -1
+				}
+				level := l.shiftLevel(delta)
+				l.Kind("logger").Warnf("log level changed to %s by %s", level, sig)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
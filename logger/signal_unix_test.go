@@ -0,0 +1,35 @@
+//go:build !windows
+
+package logger
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLogger_WatchLevelSignal(t *testing.T) {
+	l := NewLogger(t.TempDir(), "20060102")
+	defer l.Close()
+	stop := l.WatchLevelSignal()
+	defer stop()
+	for _, c := range []struct {
+		sig  syscall.Signal
+		want Level
+	}{
+		{syscall.SIGUSR1, DebugLevel},
+		{syscall.SIGUSR2, InfoLevel},
+		{syscall.SIGUSR2, WarnLevel},
+	} {
+		if err := syscall.Kill(syscall.Getpid(), c.sig); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for l.Level() != c.want {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: expect level %s, got %s", c.sig, c.want, l.Level())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package logger
+
+// WatchLevelSignal windows 不支持 SIGUSR1/SIGUSR2
+func (l *Logger) WatchLevelSignal() (stop func()) {
+	return func() {}
+}
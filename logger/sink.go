@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Encoding 日志输出格式
+type Encoding string
+
+const (
+	JSONEncoding Encoding = "json"
+	// ConsoleEncoding 便于阅读的单行文本, 级别带颜色
+	ConsoleEncoding Encoding = "console"
+)
+
+// sink 除默认文件外的一个输出
+type sink struct {
+	encoding Encoding
+	level    Level
+	writer   zapcore.WriteSyncer
+}
+
+// WithSink 增加一个输出, 只记录不低于 level 且不低于 Logger 当前级别的日志, 可多次调用
+func WithSink(encoding Encoding, level Level, w io.Writer) Option {
+	return func(l *Logger) {
+		l.sinks = append(l.sinks, sink{
+			encoding: encoding,
+			level:    level,
+			writer:   zapcore.Lock(zapcore.AddSync(w)),
+		})
+	}
+}
+
+func newEncoder(encoding Encoding) zapcore.Encoder {
+	cfg := zap.NewProductionEncoderConfig()
+	cfg.EncodeTime = func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+		enc.AppendString(t.Format("2006-01-02T15:04:05.000Z"))
+	}
+	if encoding == ConsoleEncoding {
+		cfg.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		return zapcore.NewConsoleEncoder(cfg)
+	}
+	return zapcore.NewJSONEncoder(cfg)
+}
+
+// newCore sink 的级别与 Logger 的级别同时生效
+func (l *Logger) newCore(s sink) zapcore.Core {
+	global := l.level
+	return zapcore.NewCore(newEncoder(s.encoding), s.writer, zap.LevelEnablerFunc(func(level Level) bool {
+		return global.Enabled(level) && level >= s.level
+	}))
+}
@@ -0,0 +1,224 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// slogHandler 将 slog 的记录写入 Interface, group 以 "group.key" 的形式展开
+type slogHandler struct {
+	l      Interface
+	prefix string
+}
+
+// NewSlogHandler 返回写入 l 的 slog.Handler, 用于 slog.New 或 slog.SetDefault
+func NewSlogHandler(l Interface) slog.Handler {
+	return &slogHandler{l: l}
+}
+
+// Enabled l 为 *Logger 时按其当前级别判断
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if v, ok := h.l.(interface{ Level() Level }); ok {
+		return fromSlogLevel(level) >= v.Level()
+	}
+	return true
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var args []interface{}
+	r.Attrs(func(a slog.Attr) bool {
+		args = appendAttr(args, h.prefix, a)
+		return true
+	})
+	l := h.l.Ctx(ctx)
+	if len(args) > 0 {
+		l = l.With(args...)
+	}
+	logAt(l, fromSlogLevel(r.Level), r.Message, callerOf(r.PC))
+	return nil
+}
+
+// callerOf pc 为 0 时返回未定义的 caller, 不输出 caller
+func callerOf(pc uintptr) zapcore.EntryCaller {
+	if pc == 0 {
+		return zapcore.EntryCaller{}
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	return frameCaller(frame)
+}
+
+func frameCaller(frame runtime.Frame) zapcore.EntryCaller {
+	return zapcore.EntryCaller{Defined: frame.PC != 0, PC: frame.PC, File: frame.File, Line: frame.Line, Function: frame.Function}
+}
+
+// logAt l 为 *Logger 时以 caller 作为调用位置记录, 其他实现按级别直接调用
+func logAt(l Interface, level Level, msg string, caller zapcore.EntryCaller) {
+	if v, ok := l.(*Logger); ok {
+		v.write(level, msg, caller)
+		return
+	}
+	switch level {
+	case DebugLevel:
+		l.Debug(msg)
+	case InfoLevel:
+		l.Info(msg)
+	case WarnLevel:
+		l.Warn(msg)
+	default:
+		l.Error(msg)
+	}
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var args []interface{}
+	for _, a := range attrs {
+		args = appendAttr(args, h.prefix, a)
+	}
+	if len(args) == 0 {
+		return h
+	}
+	return &slogHandler{l: h.l.With(args...), prefix: h.prefix}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{l: h.l, prefix: h.prefix + name + "."}
+}
+
+func appendAttr(args []interface{}, prefix string, a slog.Attr) []interface{} {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return args
+	}
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			args = appendAttr(args, prefix, ga)
+		}
+		return args
+	case slog.KindTime:
+		return append(args, Time(prefix+a.Key, a.Value.Time()))
+	case slog.KindDuration:
+		return append(args, Duration(prefix+a.Key, a.Value.Duration()))
+	default:
+		return append(args, Any(prefix+a.Key, a.Value.Any()))
+	}
+}
+
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return DebugLevel
+	case level < slog.LevelWarn:
+		return InfoLevel
+	case level < slog.LevelError:
+		return WarnLevel
+	default:
+		return ErrorLevel
+	}
+}
+
+// slogLogger 将 Interface 的调用转换为 slog.Record 交给 handler 处理
+type slogLogger struct {
+	// base 未加入任何字段的 handler, Kind 时从它重新开始
+	base    slog.Handler
+	handler slog.Handler
+	ctx     context.Context
+}
+
+// FromSlog 将 slog.Handler 包装为 Interface, Panic/Fatal 以 Error 级别记录后 panic/退出
+func FromSlog(h slog.Handler) Interface {
+	return &slogLogger{base: h, handler: h, ctx: context.Background()}
+}
+
+func (s *slogLogger) With(args ...interface{}) Interface {
+	return &slogLogger{base: s.base, handler: s.handler.WithAttrs(toAttrs(Fields(args...))), ctx: s.ctx}
+}
+
+func (s *slogLogger) Kind(v string) Interface {
+	return &slogLogger{base: s.base, handler: s.base.WithAttrs([]slog.Attr{slog.String("kind", v)}), ctx: s.ctx}
+}
+
+func (s *slogLogger) Ctx(ctx context.Context) Interface {
+	return &slogLogger{base: s.base, handler: s.handler.WithAttrs(toAttrs(ContextFields(ctx))), ctx: ctx}
+}
+
+// toAttrs 借助 zap 的 MapObjectEncoder 取出字段的值
+func toAttrs(fields []Field) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		for k, v := range enc.Fields {
+			attrs = append(attrs, slog.Any(k, v))
+		}
+	}
+	return attrs
+}
+
+// log skip 3 跳过 runtime.Callers, log 以及 Info 等方法
+func (s *slogLogger) log(level slog.Level, msg string) {
+	if !s.handler.Enabled(s.ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	if err := s.handler.Handle(s.ctx, r); err != nil {
+		printf("slog handle err: %v", err)
+	}
+}
+
+func (s *slogLogger) Debug(args ...interface{}) { s.log(slog.LevelDebug, fmt.Sprint(args...)) }
+func (s *slogLogger) Info(args ...interface{})  { s.log(slog.LevelInfo, fmt.Sprint(args...)) }
+func (s *slogLogger) Warn(args ...interface{})  { s.log(slog.LevelWarn, fmt.Sprint(args...)) }
+func (s *slogLogger) Error(args ...interface{}) { s.log(slog.LevelError, fmt.Sprint(args...)) }
+
+func (s *slogLogger) Panic(args ...interface{}) {
+	msg := fmt.Sprint(args...)
+	s.log(slog.LevelError, msg)
+	panic(msg)
+}
+
+func (s *slogLogger) Fatal(args ...interface{}) {
+	s.log(slog.LevelError, fmt.Sprint(args...))
+	os.Exit(1)
+}
+
+func (s *slogLogger) Debugf(template string, args ...interface{}) {
+	s.log(slog.LevelDebug, fmt.Sprintf(template, args...))
+}
+
+func (s *slogLogger) Infof(template string, args ...interface{}) {
+	s.log(slog.LevelInfo, fmt.Sprintf(template, args...))
+}
+
+func (s *slogLogger) Warnf(template string, args ...interface{}) {
+	s.log(slog.LevelWarn, fmt.Sprintf(template, args...))
+}
+
+func (s *slogLogger) Errorf(template string, args ...interface{}) {
+	s.log(slog.LevelError, fmt.Sprintf(template, args...))
+}
+
+func (s *slogLogger) Panicf(template string, args ...interface{}) {
+	msg := fmt.Sprintf(template, args...)
+	s.log(slog.LevelError, msg)
+	panic(msg)
+}
+
+func (s *slogLogger) Fatalf(template string, args ...interface{}) {
+	s.log(slog.LevelError, fmt.Sprintf(template, args...))
+	os.Exit(1)
+}
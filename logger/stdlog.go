@@ -0,0 +1,58 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// printf 输出 logger 自身的错误, 不经过标准库 log, 避免 RedirectStdLog 后写回 Logger
+func printf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "logger: "+format+"\n", args...)
+}
+
+type stdLogWriter struct {
+	l     Interface
+	level Level
+}
+
+func (w stdLogWriter) Write(p []byte) (int, error) {
+	logAt(w.l, w.level, string(bytes.TrimRight(p, "\r\n")), stdLogCaller())
+	return len(p), nil
+}
+
+// stdLogCaller 跳过 Write 以及标准库 log/slog 内部的调用, 返回调用 log.Printf 等的位置
+func stdLogCaller() zapcore.EntryCaller {
+	var pcs [16]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "log.") && !strings.HasPrefix(frame.Function, "log/slog.") {
+			return frameCaller(frame)
+		}
+		if !more {
+			return zapcore.EntryCaller{}
+		}
+	}
+}
+
+// RedirectStdLog 将标准库 log 的输出以 level 级别写入 l, 返回的函数用于恢复原来的输出
+func RedirectStdLog(l Interface, level Level) (restore func()) {
+	flags := log.Flags()
+	prefix := log.Prefix()
+	out := log.Writer()
+	log.SetFlags(0)
+	log.SetPrefix("")
+	log.SetOutput(stdLogWriter{l: l, level: level})
+	return func() {
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+		log.SetOutput(out)
+	}
+}
@@ -0,0 +1,310 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotation 文件切割/保留/压缩配置, 由 With/Kind 派生的 Logger 共享
+type rotation struct {
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+	compress   bool
+	cleaning   sync.Mutex
+}
+
+func (r *rotation) enabled() bool {
+	return r.maxBackups > 0 || r.maxAge > 0 || r.compress
+}
+
+// fileWriter 写入 <dir>/<time>.log, 超过 maxSize 时将当前文件重命名为 <time>.<n>.log 后新建
+type fileWriter struct {
+	l        *Logger
+	filename string
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	closed   bool
+}
+
+func newFileWriter(l *Logger, filename string) (*fileWriter, error) {
+	w := &fileWriter{l: l, filename: filename}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *fileWriter) open() error {
+	return w.openFile(w.filename)
+}
+
+func (w *fileWriter) openFile(name string) error {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+func (w *fileWriter) Write(p []byte) (n int, err error) {
+	if err = w.writeEntries([][]byte{p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeEntries 每条日志完整写入同一个文件, 只在条目之间切割, 同一文件内的条目合并为一次写入
+func (w *fileWriter) writeEntries(entries [][]byte) (err error) {
+	w.mu.Lock()
+	if w.closed {
+		// 切换时间段后仍持有旧 logger 的调用写入当前的 bucket, 不重新创建已切割或压缩的文件
+		w.mu.Unlock()
+		out := w.l.getBucket().writer
+		for _, p := range entries {
+			if _, writeErr := out.Write(p); err == nil {
+				err = writeErr
+			}
+		}
+		return
+	}
+	defer w.mu.Unlock()
+	var buf []byte
+	flush := func() error {
+		if len(buf) == 0 {
+			return nil
+		}
+		n, err := w.file.Write(buf)
+		w.size += int64(n)
+		buf = buf[:0]
+		return err
+	}
+	maxSize := w.l.rotation.maxSize
+	for _, p := range entries {
+		size := w.size + int64(len(buf))
+		if maxSize > 0 && size > 0 && size+int64(len(p)) > maxSize {
+			if err = flush(); err != nil {
+				return
+			}
+			if err := w.rotate(); err != nil {
+				printf("rotate log file err: %v", err)
+			}
+		}
+		buf = append(buf, p...)
+	}
+	return flush()
+}
+
+// rotate 失败时重新打开原来的文件, 保证之后的日志仍可写入
+func (w *fileWriter) rotate() error {
+	backup, err := w.backupName()
+	if err != nil {
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return w.reopen(w.filename, err)
+	}
+	if err := os.Rename(w.filename, backup); err != nil {
+		return w.reopen(w.filename, err)
+	}
+	if err := w.open(); err != nil {
+		return w.reopen(backup, err)
+	}
+	w.l.cleanup(w.filename)
+	return nil
+}
+
+func (w *fileWriter) reopen(name string, err error) error {
+	if openErr := w.openFile(name); openErr != nil {
+		printf("reopen log file err: %v", openErr)
+	}
+	return err
+}
+
+// backupName 返回第一个不存在的 <time>.<n>.log, 对应的 .gz 也不能存在
+func (w *fileWriter) backupName() (string, error) {
+	ext := filepath.Ext(w.filename)
+	prefix := strings.TrimSuffix(w.filename, ext)
+	for n := 1; ; n++ {
+		backup := fmt.Sprintf("%s.%d%s", prefix, n, ext)
+		exists, err := fileExists(backup)
+		if err == nil && !exists {
+			exists, err = fileExists(backup + ".gz")
+		}
+		if err != nil {
+			return "", err
+		} else if !exists {
+			return backup, nil
+		}
+	}
+}
+
+func fileExists(name string) (bool, error) {
+	_, err := os.Stat(name)
+	if err == nil {
+		return true, nil
+	} else if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (w *fileWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+func (w *fileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.file.Close()
+}
+
+type logFile struct {
+	path    string
+	modTime time.Time
+}
+
+// cleanup 后台压缩、删除 active 以外的日志文件
+func (l *Logger) cleanup(active string) {
+	r := l.rotation
+	if !r.enabled() {
+		return
+	}
+	go func() {
+		r.cleaning.Lock()
+		defer r.cleaning.Unlock()
+		files, err := l.logFiles(filepath.Dir(active))
+		if err != nil {
+			printf("list log files err: %v", err)
+			return
+		}
+		var remain []logFile
+		for i, f := range files {
+			if f.path == active {
+				continue
+			}
+			expired := r.maxAge > 0 && time.Since(f.modTime) > r.maxAge
+			if expired || (r.maxBackups > 0 && len(remain) >= r.maxBackups) {
+				if err := os.Remove(f.path); err != nil {
+					printf("remove log file err: %v", err)
+				}
+				continue
+			}
+			remain = append(remain, files[i])
+		}
+		if !r.compress {
+			return
+		}
+		for _, f := range remain {
+			if strings.HasSuffix(f.path, ".gz") {
+				continue
+			}
+			if err := compressFile(f.path); err != nil {
+				printf("compress log file err: %v", err)
+			}
+		}
+	}()
+}
+
+// logFiles 返回 dir 中按 TimeFormat 命名的日志文件, 最新的在前
+func (l *Logger) logFiles(dir string) ([]logFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []logFile
+	for _, entry := range entries {
+		if entry.IsDir() || !l.isLogFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, logFile{path: filepath.Join(dir, entry.Name()), modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+	return files, nil
+}
+
+// isLogFile 匹配 <time>.log / <time>.<n>.log 以及对应的 .gz
+func (l *Logger) isLogFile(name string) bool {
+	name = strings.TrimSuffix(name, ".gz")
+	if !strings.HasSuffix(name, ".log") {
+		return false
+	}
+	base := strings.TrimSuffix(name, ".log")
+	if _, err := time.Parse(l.TimeFormat, base); err == nil {
+		return true
+	}
+	i := strings.LastIndex(base, ".")
+	if i < 0 {
+		return false
+	}
+	if _, err := strconv.Atoi(base[i+1:]); err != nil {
+		return false
+	}
+	_, err := time.Parse(l.TimeFormat, base[:i])
+	return err == nil
+}
+
+// compressFile 不覆盖已存在的压缩文件
+func compressFile(filename string) (err error) {
+	if _, err = os.Stat(filename + ".gz"); err == nil {
+		return fmt.Errorf("%s.gz already exists", filename)
+	} else if !os.IsNotExist(err) {
+		return
+	}
+	src, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	tmp := filename + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return
+	}
+	if err = os.Rename(tmp, filename+".gz"); err != nil {
+		return
+	}
+	return os.Remove(filename)
+}
@@ -0,0 +1,281 @@
+package mq
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kr/beanstalk"
+)
+
+type State string
+
+const (
+	StateReady    State = "ready"
+	StateDelayed  State = "delayed"
+	StateReserved State = "reserved"
+	StateBuried   State = "buried"
+)
+
+type ServerStats struct {
+	Urgent      int
+	Ready       int
+	Reserved    int
+	Delayed     int
+	Buried      int
+	TotalJobs   int
+	Tubes       int
+	Connections int
+	Producers   int
+	Workers     int
+	Waiting     int
+	Uptime      time.Duration
+	Version     string
+	Raw         map[string]string
+}
+
+type TubeStats struct {
+	Name          string
+	Urgent        int
+	Ready         int
+	Reserved      int
+	Delayed       int
+	Buried        int
+	TotalJobs     int
+	Using         int
+	Waiting       int
+	Watching      int
+	Pause         time.Duration
+	PauseTimeLeft time.Duration
+}
+
+type JobStats struct {
+	ID       uint64
+	Tube     string
+	State    State
+	Pri      uint32
+	Age      time.Duration
+	Delay    time.Duration
+	TTR      time.Duration
+	TimeLeft time.Duration
+	Reserves int
+	Timeouts int
+	Releases int
+	Buries   int
+	Kicks    int
+}
+
+// Admin beanstalkd 管理接口, 每次调用新建连接, 与 Put 相同
+type Admin struct {
+	addr string
+}
+
+func NewAdmin(addr string) *Admin {
+	return &Admin{addr: addr}
+}
+
+func (a *Admin) Stats() (stats *ServerStats, err error) {
+	err = a.withConn(func(conn *beanstalk.Conn) error {
+		raw, err := conn.Stats()
+		if err != nil {
+			return err
+		}
+		stats = &ServerStats{
+			Urgent:      atoi(raw["current-jobs-urgent"]),
+			Ready:       atoi(raw["current-jobs-ready"]),
+			Reserved:    atoi(raw["current-jobs-reserved"]),
+			Delayed:     atoi(raw["current-jobs-delayed"]),
+			Buried:      atoi(raw["current-jobs-buried"]),
+			TotalJobs:   atoi(raw["total-jobs"]),
+			Tubes:       atoi(raw["current-tubes"]),
+			Connections: atoi(raw["current-connections"]),
+			Producers:   atoi(raw["current-producers"]),
+			Workers:     atoi(raw["current-workers"]),
+			Waiting:     atoi(raw["current-waiting"]),
+			Uptime:      seconds(raw["uptime"]),
+			Version:     raw["version"],
+			Raw:         raw,
+		}
+		return nil
+	})
+	return
+}
+
+func (a *Admin) ListTubes() (tubes []string, err error) {
+	err = a.withConn(func(conn *beanstalk.Conn) error {
+		tubes, err = conn.ListTubes()
+		return err
+	})
+	return
+}
+
+func (a *Admin) TubeStats(tube string) (stats *TubeStats, err error) {
+	err = a.withConn(func(conn *beanstalk.Conn) error {
+		t := beanstalk.Tube{Conn: conn, Name: tube}
+		raw, err := t.Stats()
+		if err != nil {
+			return convertError(err)
+		}
+		stats = &TubeStats{
+			Name:          tube,
+			Urgent:        atoi(raw["current-jobs-urgent"]),
+			Ready:         atoi(raw["current-jobs-ready"]),
+			Reserved:      atoi(raw["current-jobs-reserved"]),
+			Delayed:       atoi(raw["current-jobs-delayed"]),
+			Buried:        atoi(raw["current-jobs-buried"]),
+			TotalJobs:     atoi(raw["total-jobs"]),
+			Using:         atoi(raw["current-using"]),
+			Waiting:       atoi(raw["current-waiting"]),
+			Watching:      atoi(raw["current-watching"]),
+			Pause:         seconds(raw["pause"]),
+			PauseTimeLeft: seconds(raw["pause-time-left"]),
+		}
+		return nil
+	})
+	return
+}
+
+func (a *Admin) JobStats(id uint64) (stats *JobStats, err error) {
+	err = a.withConn(func(conn *beanstalk.Conn) error {
+		raw, err := conn.StatsJob(id)
+		if err != nil {
+			return convertError(err)
+		}
+		stats = &JobStats{
+			ID:       id,
+			Tube:     raw["tube"],
+			State:    State(raw["state"]),
+			Pri:      uint32(atoi(raw["pri"])),
+			Age:      seconds(raw["age"]),
+			Delay:    seconds(raw["delay"]),
+			TTR:      seconds(raw["ttr"]),
+			TimeLeft: seconds(raw["time-left"]),
+			Reserves: atoi(raw["reserves"]),
+			Timeouts: atoi(raw["timeouts"]),
+			Releases: atoi(raw["releases"]),
+			Buries:   atoi(raw["buries"]),
+			Kicks:    atoi(raw["kicks"]),
+		}
+		return nil
+	})
+	return
+}
+
+// PauseTube 在 d 时间内暂停 tube 的 reserve
+func (a *Admin) PauseTube(tube string, d time.Duration) error {
+	return a.withConn(func(conn *beanstalk.Conn) error {
+		t := beanstalk.Tube{Conn: conn, Name: tube}
+		return convertError(t.Pause(d))
+	})
+}
+
+// Kick 将最多 bound 个 buried (没有 buried 时为 delayed) 任务移回 ready
+func (a *Admin) Kick(tube string, bound int) (n int, err error) {
+	err = a.withConn(func(conn *beanstalk.Conn) error {
+		t := beanstalk.Tube{Conn: conn, Name: tube}
+		n, err = t.Kick(bound)
+		return err
+	})
+	return
+}
+
+func (a *Admin) PeekReady(tube string) (*Job, error) {
+	return a.peek(tube, StateReady)
+}
+
+func (a *Admin) PeekDelayed(tube string) (*Job, error) {
+	return a.peek(tube, StateDelayed)
+}
+
+func (a *Admin) PeekBuried(tube string) (*Job, error) {
+	return a.peek(tube, StateBuried)
+}
+
+func (a *Admin) peek(tube string, state State) (job *Job, err error) {
+	err = a.withConn(func(conn *beanstalk.Conn) error {
+		job, err = peek(conn, tube, state)
+		return err
+	})
+	return
+}
+
+// Purge 删除 tube 中指定状态的全部任务, 未指定状态时删除 ready/delayed/buried, reserved 任务无法删除, 指定时返回错误
+func (a *Admin) Purge(tube string, states ...State) (n int, err error) {
+	if len(states) == 0 {
+		states = []State{StateReady, StateDelayed, StateBuried}
+	}
+	for _, state := range states {
+		if err = checkPeekState(state); err != nil {
+			return
+		}
+	}
+	err = a.withConn(func(conn *beanstalk.Conn) error {
+		for _, state := range states {
+			for {
+				job, err := peek(conn, tube, state)
+				if err == ErrNotFound {
+					break
+				} else if err != nil {
+					return err
+				}
+				if err := conn.Delete(job.ID); err == nil {
+					n++
+				} else if convertError(err) != ErrNotFound {
+					// NOT_FOUND 表示已被其他连接删除或 reserve
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (a *Admin) withConn(f func(conn *beanstalk.Conn) error) error {
+	conn, err := beanstalk.Dial("tcp", a.addr)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.Error(err)
+		}
+	}()
+	return f(conn)
+}
+
+func peek(conn *beanstalk.Conn, tube string, state State) (*Job, error) {
+	t := beanstalk.Tube{Conn: conn, Name: tube}
+	var id uint64
+	var body []byte
+	var err error
+	switch state {
+	case StateReady:
+		id, body, err = t.PeekReady()
+	case StateDelayed:
+		id, body, err = t.PeekDelayed()
+	case StateBuried:
+		id, body, err = t.PeekBuried()
+	default:
+		return nil, checkPeekState(state)
+	}
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return &Job{ID: id, Tube: tube, Body: body}, nil
+}
+
+// checkPeekState 只有 ready/delayed/buried 可以 peek
+func checkPeekState(state State) error {
+	switch state {
+	case StateReady, StateDelayed, StateBuried:
+		return nil
+	case StateReserved:
+		return fmt.Errorf("mq: cannot peek or purge %s jobs", state)
+	default:
+		return fmt.Errorf("mq: unknown job state %q", state)
+	}
+}
+
+func seconds(s string) time.Duration {
+	return time.Duration(atoi(s)) * time.Second
+}
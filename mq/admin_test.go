@@ -0,0 +1,13 @@
+package mq
+
+import "testing"
+
+func TestAdmin_PurgeState(t *testing.T) {
+	// 不需要连接服务端, 状态校验在连接之前
+	a := NewAdmin("127.0.0.1:1")
+	for _, state := range []State{StateReserved, "unknown"} {
+		if n, err := a.Purge("a", state); err == nil || n != 0 {
+			t.Fatalf("expect error for state %q, got n=%d err=%v", state, n, err)
+		}
+	}
+}
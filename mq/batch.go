@@ -0,0 +1,180 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lfun125/gotool/run"
+)
+
+// BatchJob PutBatch 中的单个任务
+type BatchJob struct {
+	Tube  string
+	Body  []byte
+	Pri   uint32
+	Delay time.Duration
+	TTR   time.Duration
+}
+
+// PutResult 与 BatchJob 一一对应
+type PutResult struct {
+	ID  uint64
+	Err error
+}
+
+// maxPipeline PutBatch 同时在途的 put 数量
+const maxPipeline = 128
+
+// PutBatch 在同一个连接上并发 put, 请求以流水线方式发送, 返回每个任务的 ID 和错误
+func (p *Producer) PutBatch(jobs []BatchJob) []PutResult {
+	results := make([]PutResult, len(jobs))
+	q, err := p.queue()
+	if err != nil {
+		p.log.With("err", err).Error("queue dial error")
+		for i := range results {
+			results[i].Err = err
+		}
+		return results
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxPipeline)
+	for i := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			job := jobs[i]
+			results[i].ID, results[i].Err = q.Put(job.Tube, job.Body, job.Pri, job.Delay, job.TTR)
+		}(i)
+	}
+	wg.Wait()
+	for _, r := range results {
+		if r.Err != nil {
+			p.log.With("err", r.Err, "jobs", len(jobs)).Error("queue.Put batch failed")
+			p.reset(q)
+			break
+		}
+	}
+	return results
+}
+
+// Result 批量处理中单个任务的结果, 含义与 ProcessFunc 的返回值相同
+type Result struct {
+	Delay time.Duration
+	IsDel bool
+	Err   error
+}
+
+// BatchFunc 返回的结果与 items 一一对应, 缺少的结果按处理失败 release
+type BatchFunc func(items []*Item) []Result
+
+type batchHandler struct {
+	do     BatchFunc
+	size   int
+	window time.Duration
+}
+
+// HandleBatch 注册批量处理函数, 每次最多收集 size 个任务, 收到第一个任务后最多再等待 window;
+// 同一个 tube 不能同时使用 Handle, 需在 Run 之前调用
+func (c *Consumer) HandleBatch(tube string, do BatchFunc, size int, window time.Duration) {
+	if size < 1 {
+		size = 1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.batches[tube] = &batchHandler{do: do, size: size, window: window}
+}
+
+func (c *Consumer) watchBatch(ctx context.Context, conn *watchConn, tube string, h *batchHandler, data *Data, exit func()) {
+	run.GO(c.log, func() {
+		defer exit()
+		defer func() {
+			if err := conn.close(); err != nil {
+				c.log.Error(err)
+			}
+		}()
+		for ctx.Err() == nil {
+			items, err := c.collect(conn, tube, h)
+			if err == ErrClosed {
+				for _, item := range items {
+					item.release(item.Pri, 0)
+				}
+				return
+			} else if err != nil {
+				c.log.With("err", err, "tube", tube).Error("queue reserve error")
+				for _, item := range items {
+					item.release(item.Pri, 0)
+				}
+				data.Error <- err
+				return
+			}
+			c.processBatch(items, h)
+		}
+	}, 1)
+}
+
+// collect 阻塞直到收到第一个任务, 然后在 window 内继续收集, 直到达到 size 个
+func (c *Consumer) collect(conn *watchConn, tube string, h *batchHandler) (items []*Item, err error) {
+	var deadline time.Time
+	for len(items) < h.size {
+		timeout := 30 * time.Minute
+		if len(items) > 0 {
+			if timeout = time.Until(deadline); timeout <= 0 {
+				return
+			}
+		}
+		job, err := conn.reserve(timeout, tube)
+		if err == ErrTimeout {
+			if len(items) > 0 {
+				return items, nil
+			}
+			continue
+		} else if err != nil {
+			return items, err
+		}
+		if len(items) == 0 {
+			deadline = time.Now().Add(h.window)
+		}
+		items = append(items, c.newItem(job, conn))
+	}
+	return
+}
+
+func (c *Consumer) processBatch(items []*Item, h *batchHandler) {
+	stops := make([]func(), len(items))
+	for i, item := range items {
+		c.metrics.InFlight(item.Tube, 1)
+		stops[i] = item.keepAlive()
+	}
+	start := time.Now()
+	results := c.callBatch(items, h)
+	latency := time.Since(start)
+	for i, item := range items {
+		stops[i]()
+		r := Result{Err: fmt.Errorf("mq: no result for job %d", item.ID)}
+		if i < len(results) {
+			r = results[i]
+		}
+		c.finish(item, r.Delay, r.IsDel, r.Err, latency)
+		c.metrics.InFlight(item.Tube, -1)
+	}
+}
+
+// callBatch 处理函数 panic 时所有任务按处理失败 release
+func (c *Consumer) callBatch(items []*Item, h *batchHandler) (results []Result) {
+	defer func() {
+		if e := recover(); e != nil {
+			c.log.With("track_list", run.Tracks(), "jobs", len(items)).Error("panic", e)
+			results = nil
+			for range items {
+				results = append(results, Result{Err: fmt.Errorf("panic: %v", e)})
+			}
+		}
+	}()
+	return h.do(items)
+}
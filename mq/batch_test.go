@@ -0,0 +1,56 @@
+package mq
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProducer_PutBatch(t *testing.T) {
+	m := NewMemory()
+	p := NewProducer(m.Dial, "test", nil)
+	var jobs []BatchJob
+	for i := 0; i < 300; i++ {
+		jobs = append(jobs, BatchJob{Tube: "a", Body: []byte("x"), TTR: time.Minute})
+	}
+	seen := map[uint64]bool{}
+	for _, r := range p.PutBatch(jobs) {
+		if r.Err != nil || seen[r.ID] {
+			t.Fatalf("unexpected result %+v", r)
+		}
+		seen[r.ID] = true
+	}
+	if stats, _ := m.TubeStats("a"); stats.Ready != 300 {
+		t.Fatalf("expect 300 ready, got %d", stats.Ready)
+	}
+}
+
+func TestConsumer_HandleBatch(t *testing.T) {
+	m := NewMemory()
+	for i := 0; i < 5; i++ {
+		m.Put("a", []byte("x"), 0, 0, time.Minute)
+	}
+	sizes := make(chan int, 5)
+	c := NewConsumer(m.Dial, "test", nil)
+	c.HandleBatch("a", func(items []*Item) []Result {
+		sizes <- len(items)
+		results := make([]Result, len(items))
+		for i := range items {
+			results[i].IsDel = true
+		}
+		// 最后一个任务 bury
+		results[len(items)-1] = Result{Err: Bury(errors.New("bad"))}
+		return results
+	}, 3, 50*time.Millisecond)
+	runConsumer(t, c)
+	if n := <-sizes; n != 3 {
+		t.Fatalf("expect first batch of 3, got %d", n)
+	}
+	if n := <-sizes; n != 2 {
+		t.Fatalf("expect second batch of 2 after window, got %d", n)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if stats, _ := m.TubeStats("a"); stats.Buried != 2 || stats.Ready+stats.Reserved != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,90 @@
+package mq
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/kr/beanstalk"
+)
+
+// releasePri 取不到任务原优先级时放回使用的优先级, 与默认的 FixedPriority 相同
+const releasePri = 1024
+
+type beanstalkQueue struct {
+	conn *beanstalk.Conn
+}
+
+// Beanstalk 返回连接 beanstalkd 的 Dialer
+func Beanstalk(addr string) Dialer {
+	return func() (Queue, error) {
+		conn, err := beanstalk.Dial("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return &beanstalkQueue{conn: conn}, nil
+	}
+}
+
+func (q *beanstalkQueue) Put(tube string, body []byte, pri uint32, delay, ttr time.Duration) (uint64, error) {
+	t := beanstalk.Tube{Conn: q.conn, Name: tube}
+	return t.Put(body, pri, delay, ttr)
+}
+
+func (q *beanstalkQueue) Reserve(timeout time.Duration, tubes ...string) (*Job, error) {
+	tubeSet := beanstalk.NewTubeSet(q.conn, tubes...)
+	id, body, err := tubeSet.Reserve(timeout)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	job := &Job{ID: id, Body: body}
+	stats, err := q.conn.StatsJob(id)
+	if err != nil {
+		// 取不到 tube 无法处理, 放回后按超时返回由调用方重新 reserve, 放回也失败时返回原错误
+		if q.conn.Release(id, releasePri, 0) != nil {
+			return nil, convertError(err)
+		}
+		return nil, ErrTimeout
+	}
+	job.Tube = stats["tube"]
+	job.Pri = uint32(atoi(stats["pri"]))
+	job.TTR = time.Duration(atoi(stats["ttr"])) * time.Second
+	job.Reserves = atoi(stats["reserves"])
+	return job, nil
+}
+
+func (q *beanstalkQueue) Delete(id uint64) error {
+	return convertError(q.conn.Delete(id))
+}
+
+func (q *beanstalkQueue) Release(id uint64, pri uint32, delay time.Duration) error {
+	return convertError(q.conn.Release(id, pri, delay))
+}
+
+func (q *beanstalkQueue) Bury(id uint64, pri uint32) error {
+	return convertError(q.conn.Bury(id, pri))
+}
+
+func (q *beanstalkQueue) Touch(id uint64) error {
+	return convertError(q.conn.Touch(id))
+}
+
+func (q *beanstalkQueue) Close() error {
+	return q.conn.Close()
+}
+
+func convertError(err error) error {
+	if e, ok := err.(beanstalk.ConnError); ok {
+		switch e.Err {
+		case beanstalk.ErrTimeout, beanstalk.ErrDeadline:
+			return ErrTimeout
+		case beanstalk.ErrNotFound:
+			return ErrNotFound
+		}
+	}
+	return err
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,45 @@
+package mq
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// BodyFormat 决定 reserve 日志中如何记录消息体, 为 nil 时只记录长度
+type BodyFormat func(body []byte) interface{}
+
+// BodyFull 记录完整消息体
+func BodyFull() BodyFormat {
+	return func(body []byte) interface{} {
+		return string(body)
+	}
+}
+
+// BodyTruncate 最多记录 n 个字节, n 小于 0 时按 0 处理
+func BodyTruncate(n int) BodyFormat {
+	if n < 0 {
+		n = 0
+	}
+	return func(body []byte) interface{} {
+		if len(body) <= n {
+			return string(body)
+		}
+		return fmt.Sprintf("%s...(%d bytes truncated)", body[:n], len(body)-n)
+	}
+}
+
+// BodyHash 只记录消息体的 sha256
+func BodyHash() BodyFormat {
+	return func(body []byte) interface{} {
+		sum := sha256.Sum256(body)
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+}
+
+// BodyRedact 记录 redact 处理后的消息体
+func BodyRedact(redact func(body []byte) []byte) BodyFormat {
+	return func(body []byte) interface{} {
+		return string(redact(body))
+	}
+}
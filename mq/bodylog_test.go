@@ -0,0 +1,65 @@
+package mq
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lfun125/gotool/logger"
+	"github.com/lfun125/gotool/logger/loggertest"
+)
+
+func TestBodyTruncate(t *testing.T) {
+	for n, want := range map[int]string{
+		-1: "...(5 bytes truncated)",
+		3:  "hel...(2 bytes truncated)",
+		5:  "hello",
+		10: "hello",
+	} {
+		if got := BodyTruncate(n)([]byte("hello")); got != want {
+			t.Fatalf("%d: expect %q, got %q", n, want, got)
+		}
+	}
+}
+
+// reserveLog 消费一条消息并返回 "reserve new message" 日志
+func reserveLog(t *testing.T, options ...Option) loggertest.Entry {
+	m := NewMemory()
+	m.Put("a", []byte("secret body"), 0, 0, time.Minute)
+	rec := loggertest.New()
+	c := NewConsumer(m.Dial, "test", rec, options...)
+	done := make(chan struct{})
+	c.Handle("a", func(item *Item) (time.Duration, bool, error) {
+		close(done)
+		return 0, true, nil
+	}, 1)
+	runConsumer(t, c)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job not processed")
+	}
+	entries := rec.Filter(logger.InfoLevel, "reserve new message")
+	if len(entries) != 1 {
+		t.Fatalf("expect 1 reserve log, got %d", len(entries))
+	}
+	return entries[0]
+}
+
+func TestConsumer_BodyLog(t *testing.T) {
+	// 默认只记录长度
+	e := reserveLog(t)
+	if _, ok := e.Map()["body"]; ok || !e.Has("body_size", 11) {
+		t.Fatalf("unexpected default fields: %v", e.Map())
+	}
+	e = reserveLog(t, WithBodyLog(BodyTruncate(6)))
+	if !e.Has("body", "secret...(5 bytes truncated)") {
+		t.Fatalf("unexpected truncated body: %v", e.Map())
+	}
+	e = reserveLog(t, WithBodyLog(func(body []byte) interface{} {
+		return strings.ToUpper(string(body))
+	}))
+	if !e.Has("body", "SECRET BODY") {
+		t.Fatalf("unexpected custom body: %v", e.Map())
+	}
+}
@@ -0,0 +1,354 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lfun125/gotool/logger"
+	"github.com/lfun125/gotool/run"
+)
+
+type handler struct {
+	do          ProcessFunc
+	concurrency int
+	inflight    int
+	// claimed 正在 reserve 该 tube 的连接数, inflight+claimed 不超过 concurrency
+	claimed int
+}
+
+// Consumer 基于任意 Queue 实现的消费者, 可同时消费多个 tube
+type Consumer struct {
+	dial     Dialer
+	tag      string
+	log      logger.Interface
+	retry    RetryPolicy
+	priority PriorityFunc
+	metrics  Metrics
+	chain    []Middleware
+	bodyLog  BodyFormat
+	mu       sync.Mutex
+	cond     *sync.Cond
+	tubes    []string
+	handlers map[string]*handler
+	batches  map[string]*batchHandler
+	cancel   context.CancelFunc
+	closed   bool
+}
+
+// NewConsumer log 为 nil 时不记录日志
+func NewConsumer(dial Dialer, tag string, log logger.Interface, options ...Option) *Consumer {
+	if log == nil {
+		log = logger.NewNop()
+	}
+	c := &Consumer{}
+	c.dial = dial
+	c.tag = tag
+	c.log = log.With("tag", tag)
+	c.retry = FixedRetry(15 * time.Second)
+	c.priority = FixedPriority(1024)
+	c.metrics = nopMetrics{}
+	c.chain = []Middleware{Recover()}
+	c.cond = sync.NewCond(&c.mu)
+	c.handlers = map[string]*handler{}
+	c.batches = map[string]*batchHandler{}
+	for _, opt := range options {
+		opt(c)
+	}
+	return c
+}
+
+// Handle 注册 tube 的处理函数, concurrency 为该 tube 同时处理的任务数上限, 需在 Run 之前调用
+func (c *Consumer) Handle(tube string, do ProcessFunc, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.handlers[tube]; !ok {
+		c.tubes = append(c.tubes, tube)
+	}
+	c.handlers[tube] = &handler{do: Chain(c.chain...)(do), concurrency: concurrency}
+}
+
+func (c *Consumer) Subscribe(tube string, do ProcessFunc) (err error) {
+	c.Handle(tube, do, 1)
+	return c.Run()
+}
+
+// Run 每个并发占用一个连接, 所有连接同时 reserve 已注册的 tube, 每个批量处理的 tube 单独占用一个连接;
+// 任一连接出错时返回该错误, 调用 Close 时返回 nil, 返回前会停止所有连接并等待处理中的任务完成
+func (c *Consumer) Run() (err error) {
+	var workers int
+	for _, h := range c.handlers {
+		workers += h.concurrency
+	}
+	if workers+len(c.batches) == 0 {
+		return errors.New("mq: no handler registered")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		cancel()
+		return nil
+	}
+	c.cancel = cancel
+	c.mu.Unlock()
+
+	var conns []*watchConn
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		c.mu.Lock()
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		for _, conn := range conns {
+			conn.cancel()
+		}
+		wg.Wait()
+	}()
+	dial := func() (conn *watchConn, err error) {
+		var q Queue
+		if q, err = c.dial(); err != nil {
+			return
+		}
+		conn = &watchConn{Queue: q}
+		conns = append(conns, conn)
+		wg.Add(1)
+		return
+	}
+	data := newData(workers + len(c.batches))
+	for i := 0; i < workers; i++ {
+		var conn *watchConn
+		if conn, err = dial(); err != nil {
+			return
+		}
+		c.watch(ctx, conn, data, wg.Done)
+	}
+	for tube, h := range c.batches {
+		var conn *watchConn
+		if conn, err = dial(); err != nil {
+			return
+		}
+		c.watchBatch(ctx, conn, tube, h, data, wg.Done)
+	}
+	for {
+		select {
+		case err = <-data.Error:
+			return
+		case <-ctx.Done():
+			return nil
+		case item := <-data.Item:
+			h := c.handlers[item.Tube]
+			run.GO(c.log, func() {
+				c.process(item, h)
+			}, 1)
+		}
+	}
+}
+
+// Close 停止 Run, 不再 reserve 新任务, Close 之后不能再次 Run
+func (c *Consumer) Close() {
+	c.mu.Lock()
+	c.closed = true
+	cancel := c.cancel
+	c.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// watchConn 停止时关闭正在 reserve 的连接使其立即返回, 正在处理任务的连接由 watcher 处理完成后关闭
+type watchConn struct {
+	Queue
+	mu        sync.Mutex
+	reserving bool
+	canceled  bool
+	once      sync.Once
+}
+
+// reserve 停止后返回 ErrClosed
+func (w *watchConn) reserve(timeout time.Duration, tubes ...string) (*Job, error) {
+	w.mu.Lock()
+	if w.canceled {
+		w.mu.Unlock()
+		return nil, ErrClosed
+	}
+	w.reserving = true
+	w.mu.Unlock()
+	job, err := w.Queue.Reserve(timeout, tubes...)
+	w.mu.Lock()
+	w.reserving = false
+	canceled := w.canceled
+	w.mu.Unlock()
+	if canceled {
+		if err == nil {
+			w.Queue.Release(job.ID, job.Pri, 0)
+		}
+		return nil, ErrClosed
+	}
+	return job, err
+}
+
+func (w *watchConn) cancel() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.canceled = true
+	if w.reserving {
+		w.close()
+	}
+}
+
+func (w *watchConn) close() (err error) {
+	w.once.Do(func() {
+		err = w.Queue.Close()
+	})
+	return
+}
+
+func (c *Consumer) watch(ctx context.Context, conn *watchConn, data *Data, exit func()) {
+	run.GO(c.log, func() {
+		defer exit()
+		defer func() {
+			if err := conn.close(); err != nil {
+				c.log.Error(err)
+			}
+		}()
+		for {
+			tubes := c.claim(ctx)
+			if len(tubes) == 0 {
+				return
+			}
+			job, err := conn.reserve(30*time.Minute, tubes...)
+			var h *handler
+			if err == nil {
+				h = c.settle(tubes, job.Tube)
+			} else {
+				c.settle(tubes, "")
+			}
+			if err == ErrTimeout {
+				continue
+			} else if err == ErrClosed {
+				return
+			} else if err != nil {
+				c.log.With("err", err).Error("queue reserve error")
+				data.Error <- err
+				return
+			}
+			item := c.newItem(job, conn)
+			item.Wait.Add(1)
+			select {
+			case data.Item <- item:
+			case <-ctx.Done():
+				item.release(item.Pri, 0)
+				c.done(h)
+				return
+			}
+			item.Wait.Wait()
+		}
+	}, 1)
+}
+
+func (c *Consumer) newItem(job *Job, q Queue) *Item {
+	item := &Item{
+		Body:     job.Body,
+		ID:       job.ID,
+		Tube:     job.Tube,
+		Pri:      job.Pri,
+		TTR:      job.TTR,
+		Reserves: job.Reserves,
+		Queue:    q,
+		Wait:     sync.WaitGroup{},
+		log:      c.log.With("tube", job.Tube, "id", job.ID),
+	}
+	item.ctx = logger.WithContext(context.Background(), item.log)
+	entry := item.log.With("body_size", len(job.Body))
+	if c.bodyLog != nil {
+		entry = entry.With("body", c.bodyLog(job.Body))
+	}
+	entry.Info("reserve new message")
+	return item
+}
+
+// claim 占用所有仍有空闲并发的 tube 各一个并发后返回这些 tube, 全部占满时阻塞, 停止后返回 nil;
+// 只 reserve 有空闲并发的 tube, 不会因超出并发而放回任务增加 reserves
+func (c *Consumer) claim(ctx context.Context) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		var tubes []string
+		for _, tube := range c.tubes {
+			if h := c.handlers[tube]; h.inflight+h.claimed < h.concurrency {
+				h.claimed++
+				tubes = append(tubes, tube)
+			}
+		}
+		if len(tubes) > 0 {
+			return tubes
+		}
+		c.cond.Wait()
+	}
+}
+
+// settle 归还 claim 占用的并发, tube 不为空时将其转为处理中并返回对应的 handler
+func (c *Consumer) settle(tubes []string, tube string) (h *handler) {
+	c.mu.Lock()
+	for _, t := range tubes {
+		c.handlers[t].claimed--
+	}
+	if tube != "" {
+		h = c.handlers[tube]
+		h.inflight++
+	}
+	c.mu.Unlock()
+	c.cond.Broadcast()
+	return
+}
+
+func (c *Consumer) done(h *handler) {
+	c.mu.Lock()
+	h.inflight--
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+func (c *Consumer) process(item *Item, h *handler) {
+	defer func() {
+		c.done(h)
+		item.Wait.Done()
+	}()
+
+	c.metrics.InFlight(item.Tube, 1)
+	defer c.metrics.InFlight(item.Tube, -1)
+	stop := item.keepAlive()
+	start := time.Now()
+	delay, isDel, err := h.do(item)
+	latency := time.Since(start)
+	stop()
+	c.finish(item, delay, isDel, err, latency)
+}
+
+// finish 按处理结果删除/bury/release 任务
+func (c *Consumer) finish(item *Item, delay time.Duration, isDel bool, err error, latency time.Duration) {
+	if err != nil {
+		item.log.Error(err)
+	}
+	if isDel {
+		c.metrics.JobHandled(item.Tube, ActionDelete, err, latency)
+		item.delete()
+	} else if isBury(err) {
+		c.metrics.JobHandled(item.Tube, ActionBury, err, latency)
+		item.bury(item.Pri)
+	} else {
+		if err != nil && delay == 0 {
+			delay = c.retry.Delay(item.Reserves)
+		}
+		c.metrics.JobHandled(item.Tube, ActionRelease, err, latency)
+		item.release(c.priority(item.Pri, item.Reserves), delay)
+	}
+}
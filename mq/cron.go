@@ -0,0 +1,187 @@
+package mq
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule 计算 t 之后的下一次执行时间, 返回零值表示不再执行
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+type every time.Duration
+
+// Every 固定间隔执行, d 必须大于 0
+func Every(d time.Duration) Schedule {
+	if d <= 0 {
+		panic("mq: non-positive interval for Every")
+	}
+	return every(d)
+}
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// dom/dow 都不是 * 时任一满足即可
+	domStar, dowStar bool
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronMinute = cronField{0, 59, nil}
+	cronHour   = cronField{0, 23, nil}
+	cronDom    = cronField{1, 31, nil}
+	cronMonth  = cronField{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	cronDow = cronField{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron 解析标准 5 段 cron 表达式 (分 时 日 月 周), 支持 @hourly/@daily 等以及 "@every 1h"
+func ParseCron(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("mq: invalid cron %q: %w", expr, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("mq: invalid cron %q: interval must be positive", expr)
+		}
+		return Every(d), nil
+	}
+	if v, ok := cronDescriptors[expr]; ok {
+		expr = v
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("mq: invalid cron %q: expect 5 fields", expr)
+	}
+	s := &cronSchedule{}
+	var err error
+	if s.minute, err = parseCronField(fields[0], cronMinute); err != nil {
+		return nil, fmt.Errorf("mq: invalid cron %q: %w", expr, err)
+	}
+	if s.hour, err = parseCronField(fields[1], cronHour); err != nil {
+		return nil, fmt.Errorf("mq: invalid cron %q: %w", expr, err)
+	}
+	if s.dom, err = parseCronField(fields[2], cronDom); err != nil {
+		return nil, fmt.Errorf("mq: invalid cron %q: %w", expr, err)
+	}
+	if s.month, err = parseCronField(fields[3], cronMonth); err != nil {
+		return nil, fmt.Errorf("mq: invalid cron %q: %w", expr, err)
+	}
+	if s.dow, err = parseCronField(fields[4], cronDow); err != nil {
+		return nil, fmt.Errorf("mq: invalid cron %q: %w", expr, err)
+	}
+	// 7 和 0 都表示周日
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = fields[2] == "*" || fields[2] == "?"
+	s.dowStar = fields[4] == "*" || fields[4] == "?"
+	return s, nil
+}
+
+func parseCronField(field string, f cronField) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step %q", part)
+			}
+			part = part[:i]
+		}
+		lo, hi := f.min, f.max
+		if part != "*" && part != "?" {
+			bounds := strings.SplitN(part, "-", 2)
+			if lo, err = f.value(bounds[0]); err != nil {
+				return
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = f.value(bounds[1]); err != nil {
+					return
+				}
+			} else if step > 1 {
+				hi = f.max
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("bad range %q", part)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %q out of range [%d, %d]", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,115 @@
+package mq
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// KeyFunc 返回任务的去重键, 返回空字符串时不去重
+type KeyFunc func(item *Item) string
+
+// EnvelopeKey 使用信封中的消息 ID 作为去重键
+func EnvelopeKey(item *Item) string {
+	var e struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(item.Body, &e); err != nil {
+		return ""
+	}
+	return e.ID
+}
+
+// DedupStore 记录已处理完成的去重键
+type DedupStore interface {
+	Seen(key string) (bool, error)
+	Mark(key string) error
+}
+
+// Dedup 已处理过的任务直接删除, 不调用处理函数; key 为 nil 时使用 EnvelopeKey
+func Dedup(store DedupStore, key KeyFunc) Middleware {
+	if key == nil {
+		key = EnvelopeKey
+	}
+	return func(next ProcessFunc) ProcessFunc {
+		return func(item *Item) (delay time.Duration, isDel bool, err error) {
+			k := key(item)
+			if k == "" {
+				return next(item)
+			}
+			if seen, err := store.Seen(k); err != nil {
+				item.Logger().With("err", err, "key", k).Error("mq.DedupStore.Seen")
+			} else if seen {
+				item.Logger().With("key", k).Info("skip duplicate message")
+				return 0, true, nil
+			}
+			delay, isDel, err = next(item)
+			if isDel {
+				if err := store.Mark(k); err != nil {
+					item.Logger().With("err", err, "key", k).Error("mq.DedupStore.Mark")
+				}
+			}
+			return
+		}
+	}
+}
+
+type lruEntry struct {
+	key     string
+	expires time.Time
+}
+
+// LRUStore 内存中的 DedupStore, 最多保存 size 个键, 每个键保存 ttl 时间
+type LRUStore struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	list  *list.List
+	items map[string]*list.Element
+}
+
+func NewLRUStore(size int, ttl time.Duration) *LRUStore {
+	s := &LRUStore{}
+	s.size = size
+	s.ttl = ttl
+	s.list = list.New()
+	s.items = map[string]*list.Element{}
+	return s
+}
+
+func (s *LRUStore) Seen(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return false, nil
+	}
+	if time.Now().After(el.Value.(*lruEntry).expires) {
+		s.remove(el)
+		return false, nil
+	}
+	s.list.MoveToFront(el)
+	return true, nil
+}
+
+func (s *LRUStore) Mark(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires := time.Now().Add(s.ttl)
+	if el, ok := s.items[key]; ok {
+		el.Value.(*lruEntry).expires = expires
+		s.list.MoveToFront(el)
+		return nil
+	}
+	s.items[key] = s.list.PushFront(&lruEntry{key: key, expires: expires})
+	for s.size > 0 && s.list.Len() > s.size {
+		s.remove(s.list.Back())
+	}
+	return nil
+}
+
+func (s *LRUStore) remove(el *list.Element) {
+	s.list.Remove(el)
+	delete(s.items, el.Value.(*lruEntry).key)
+}
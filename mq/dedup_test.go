@@ -0,0 +1,40 @@
+package mq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDedup(t *testing.T) {
+	var calls int
+	do := Dedup(NewLRUStore(2, time.Minute), nil)(func(item *Item) (time.Duration, bool, error) {
+		calls++
+		return 0, true, nil
+	})
+	body, _ := Marshal(JSON, map[string]int{"a": 1})
+	for i := 0; i < 3; i++ {
+		if _, isDel, err := do(&Item{Body: body}); !isDel || err != nil {
+			t.Fatalf("expect delete, got %v %v", isDel, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expect handler to be called once, got %d", calls)
+	}
+}
+
+func TestLRUStore(t *testing.T) {
+	s := NewLRUStore(2, 50*time.Millisecond)
+	s.Mark("a")
+	s.Mark("b")
+	s.Mark("c")
+	if seen, _ := s.Seen("a"); seen {
+		t.Fatal("expect a to be evicted")
+	}
+	if seen, _ := s.Seen("c"); !seen {
+		t.Fatal("expect c to be seen")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if seen, _ := s.Seen("c"); seen {
+		t.Fatal("expect c to be expired")
+	}
+}
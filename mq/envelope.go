@@ -0,0 +1,247 @@
+package mq
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultProducer 未指定生产者名称时写入信封的名称
+var DefaultProducer = filepath.Base(os.Args[0])
+
+// Envelope 消息信封, 负载按 Encoding 对应的 Codec 编码
+type Envelope struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Producer  string          `json:"producer"`
+	Version   int             `json:"version"`
+	Encoding  string          `json:"encoding"`
+	Payload   json.RawMessage `json:"payload"`
+	// ReplyTo 请求/响应模式中响应投递的 tube
+	ReplyTo string `json:"reply_to,omitempty"`
+	// CorrelationID 响应对应的请求消息 ID
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// Error 响应中处理函数返回的错误
+	Error string `json:"error,omitempty"`
+}
+
+// Codec 负载编解码, 编码结果必须是合法的 JSON
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	JSON  Codec = jsonCodec{}
+	Proto Codec = protoCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Name() string {
+	return "protojson"
+}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("mq: %T is not a proto.Message", v)
+	}
+	return protojson.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("mq: %T is not a proto.Message", v)
+	}
+	return protojson.Unmarshal(data, m)
+}
+
+type EnvelopeOption func(e *Envelope)
+
+// WithID 指定消息 ID 代替随机生成的 ID, 重复投递同一条消息时 ID 保持不变, 可用于 Dedup
+func WithID(id string) EnvelopeOption {
+	return func(e *Envelope) {
+		e.ID = id
+	}
+}
+
+func WithType(typ string) EnvelopeOption {
+	return func(e *Envelope) {
+		e.Type = typ
+	}
+}
+
+func WithProducer(name string) EnvelopeOption {
+	return func(e *Envelope) {
+		e.Producer = name
+	}
+}
+
+func WithVersion(version int) EnvelopeOption {
+	return func(e *Envelope) {
+		e.Version = version
+	}
+}
+
+func WithReplyTo(tube string) EnvelopeOption {
+	return func(e *Envelope) {
+		e.ReplyTo = tube
+	}
+}
+
+func WithCorrelationID(id string) EnvelopeOption {
+	return func(e *Envelope) {
+		e.CorrelationID = id
+	}
+}
+
+// Marshal 将 v 编码后装入信封, 返回可直接投递的消息体
+func Marshal(codec Codec, v interface{}, options ...EnvelopeOption) ([]byte, error) {
+	payload, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	e := &Envelope{
+		ID:        newMessageID(),
+		Type:      typeName(v),
+		CreatedAt: time.Now(),
+		Producer:  DefaultProducer,
+		Version:   1,
+		Encoding:  codec.Name(),
+		Payload:   payload,
+	}
+	for _, opt := range options {
+		opt(e)
+	}
+	return json.Marshal(e)
+}
+
+// Unmarshal 解析信封并将负载解码到 v
+func Unmarshal(codec Codec, body []byte, v interface{}) (*Envelope, error) {
+	e := &Envelope{}
+	if err := json.Unmarshal(body, e); err != nil {
+		return nil, fmt.Errorf("mq: decode envelope: %w", err)
+	}
+	if e.Encoding != codec.Name() {
+		return e, fmt.Errorf("mq: unexpected encoding %q, want %q", e.Encoding, codec.Name())
+	}
+	if err := codec.Unmarshal(e.Payload, v); err != nil {
+		return e, fmt.Errorf("mq: decode payload: %w", err)
+	}
+	return e, nil
+}
+
+func PutJSON(addr, tube string, v interface{}, pri uint32, delay, ttr time.Duration, options ...EnvelopeOption) (id uint64, err error) {
+	var body []byte
+	if body, err = Marshal(JSON, v, options...); err != nil {
+		return
+	}
+	return Put(addr, body, tube, pri, delay, ttr)
+}
+
+func PutProto(addr, tube string, m proto.Message, pri uint32, delay, ttr time.Duration, options ...EnvelopeOption) (id uint64, err error) {
+	var body []byte
+	if body, err = Marshal(Proto, m, options...); err != nil {
+		return
+	}
+	return Put(addr, body, tube, pri, delay, ttr)
+}
+
+// Message 解码后的消息
+type Message[T any] struct {
+	Envelope
+	Value *T
+	Item  *Item
+}
+
+type MessageFunc[T any] func(msg *Message[T]) (delay time.Duration, isDel bool, err error)
+
+// Decode 将 MessageFunc 转换为 ProcessFunc, 无法解码的消息会被 bury
+func Decode[T any](codec Codec, do MessageFunc[T]) ProcessFunc {
+	return func(item *Item) (delay time.Duration, isDel bool, err error) {
+		msg := &Message[T]{Value: new(T), Item: item}
+		e, err := Unmarshal(codec, item.Body, msg.Value)
+		if err != nil {
+			return 0, false, Bury(err)
+		}
+		msg.Envelope = *e
+		return do(msg)
+	}
+}
+
+func SubscribeJSON[T any](addr, tube, tag string, do MessageFunc[T]) error {
+	return Subscribe(addr, tube, tag, Decode(JSON, do))
+}
+
+// SubscribeProto T 为 protobuf 生成的消息结构体类型 (非指针)
+func SubscribeProto[T any](addr, tube, tag string, do MessageFunc[T]) error {
+	return Subscribe(addr, tube, tag, Decode(Proto, do))
+}
+
+// BuryError ProcessFunc 返回该错误时任务会被 bury 而不是 release
+type BuryError struct {
+	Err error
+}
+
+func (e *BuryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BuryError) Unwrap() error {
+	return e.Err
+}
+
+func Bury(err error) error {
+	return &BuryError{Err: err}
+}
+
+func isBury(err error) bool {
+	var target *BuryError
+	return errors.As(err, &target)
+}
+
+func newMessageID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+func typeName(v interface{}) string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
@@ -0,0 +1,79 @@
+package mq
+
+import (
+	"testing"
+	"time"
+)
+
+type orderCreated struct {
+	OrderID int    `json:"order_id"`
+	User    string `json:"user"`
+}
+
+func TestMarshal(t *testing.T) {
+	body, err := Marshal(JSON, &orderCreated{OrderID: 1, User: "a"}, WithProducer("shop"), WithVersion(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &orderCreated{}
+	e, err := Unmarshal(JSON, body, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *v != (orderCreated{OrderID: 1, User: "a"}) {
+		t.Fatalf("unexpected payload %+v", v)
+	}
+	if e.ID == "" || e.Type != "mq.orderCreated" || e.Producer != "shop" || e.Version != 2 ||
+		e.Encoding != "json" || e.CreatedAt.IsZero() {
+		t.Fatalf("unexpected envelope %+v", e)
+	}
+	if _, err := Unmarshal(Proto, body, v); err == nil {
+		t.Fatal("expect encoding mismatch error")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	m := NewMemory()
+	body, err := Marshal(JSON, &orderCreated{OrderID: 7, User: "b"}, WithType("order.created"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Put("orders", body, 0, 0, time.Minute)
+	m.Put("orders", []byte("not an envelope"), 0, 0, time.Minute)
+	received := make(chan *Message[orderCreated], 2)
+	c := NewConsumer(m.Dial, "test", nil)
+	c.Handle("orders", Decode(JSON, func(msg *Message[orderCreated]) (time.Duration, bool, error) {
+		received <- msg
+		return 0, true, nil
+	}), 1)
+	runConsumer(t, c)
+	var msg *Message[orderCreated]
+	select {
+	case msg = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("message not consumed")
+	}
+	if msg.Value.OrderID != 7 || msg.Value.User != "b" || msg.Item == nil {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	if msg.ID == "" || msg.Type != "order.created" || msg.Producer != DefaultProducer || msg.Version != 1 ||
+		msg.Encoding != "json" || msg.CreatedAt.IsZero() {
+		t.Fatalf("unexpected envelope %+v", msg.Envelope)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		stats, _ := m.TubeStats("orders")
+		if stats.Buried == 1 && stats.Ready+stats.Reserved == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect garbage body to be buried, got %+v", stats)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case msg = <-received:
+		t.Fatalf("undecodable message passed to handler: %+v", msg)
+	default:
+	}
+}
@@ -0,0 +1,239 @@
+package mq
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryJob struct {
+	Job
+	state State
+	until time.Time
+}
+
+// Memory 内存队列, 支持延迟/优先级/TTR, 用于测试和本地开发
+type Memory struct {
+	mu     sync.Mutex
+	nextID uint64
+	jobs   map[uint64]*memoryJob
+	notify chan struct{}
+}
+
+func NewMemory() *Memory {
+	m := &Memory{}
+	m.jobs = map[uint64]*memoryJob{}
+	m.notify = make(chan struct{})
+	return m
+}
+
+// memoryConn Close 后 Reserve 立即返回 ErrClosed, 其他操作仍作用于共享的内存队列
+type memoryConn struct {
+	*Memory
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *memoryConn) Reserve(timeout time.Duration, tubes ...string) (*Job, error) {
+	return c.reserve(timeout, c.closed, tubes...)
+}
+
+func (c *memoryConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+// Dial 实现 Dialer, 所有连接共享同一个内存队列
+func (m *Memory) Dial() (Queue, error) {
+	return &memoryConn{Memory: m, closed: make(chan struct{})}, nil
+}
+
+func (m *Memory) Put(tube string, body []byte, pri uint32, delay, ttr time.Duration) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	job := &memoryJob{}
+	job.ID = m.nextID
+	job.Tube = tube
+	job.Body = append([]byte(nil), body...)
+	job.Pri = pri
+	job.TTR = ttr
+	if job.TTR < time.Second {
+		job.TTR = time.Second
+	}
+	m.delay(job, delay)
+	m.jobs[job.ID] = job
+	m.broadcast()
+	return job.ID, nil
+}
+
+func (m *Memory) Reserve(timeout time.Duration, tubes ...string) (*Job, error) {
+	return m.reserve(timeout, nil, tubes...)
+}
+
+func (m *Memory) reserve(timeout time.Duration, closed <-chan struct{}, tubes ...string) (*Job, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case <-closed:
+			return nil, ErrClosed
+		default:
+		}
+		m.mu.Lock()
+		now := time.Now()
+		wake := deadline
+		var found *memoryJob
+		for _, job := range m.jobs {
+			if job.state == StateDelayed || job.state == StateReserved {
+				if !job.until.After(now) {
+					job.state = StateReady
+				} else if job.until.Before(wake) {
+					wake = job.until
+				}
+			}
+			if job.state != StateReady || !contains(tubes, job.Tube) {
+				continue
+			}
+			if found == nil || job.Pri < found.Pri || (job.Pri == found.Pri && job.ID < found.ID) {
+				found = job
+			}
+		}
+		if found != nil {
+			found.state = StateReserved
+			found.until = now.Add(found.TTR)
+			found.Reserves++
+			job := found.Job
+			job.Body = append([]byte(nil), found.Body...)
+			m.mu.Unlock()
+			return &job, nil
+		}
+		notify := m.notify
+		m.mu.Unlock()
+		if !now.Before(deadline) {
+			return nil, ErrTimeout
+		}
+		timer := time.NewTimer(wake.Sub(now))
+		select {
+		case <-notify:
+		case <-timer.C:
+		case <-closed:
+			timer.Stop()
+			return nil, ErrClosed
+		}
+		timer.Stop()
+	}
+}
+
+func (m *Memory) Delete(id uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.jobs[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.jobs, id)
+	return nil
+}
+
+func (m *Memory) Release(id uint64, pri uint32, delay time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.reserved(id)
+	if !ok {
+		return ErrNotFound
+	}
+	job.Pri = pri
+	m.delay(job, delay)
+	m.broadcast()
+	return nil
+}
+
+func (m *Memory) Bury(id uint64, pri uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.reserved(id)
+	if !ok {
+		return ErrNotFound
+	}
+	job.Pri = pri
+	job.state = StateBuried
+	return nil
+}
+
+func (m *Memory) Touch(id uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.reserved(id)
+	if !ok {
+		return ErrNotFound
+	}
+	job.until = time.Now().Add(job.TTR)
+	return nil
+}
+
+// TubeStats 与 Admin.TubeStats 相同, 仅统计任务数
+func (m *Memory) TubeStats(tube string) (*TubeStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := &TubeStats{Name: tube}
+	now := time.Now()
+	for _, job := range m.jobs {
+		if job.Tube != tube {
+			continue
+		}
+		state := job.state
+		if (state == StateDelayed || state == StateReserved) && !job.until.After(now) {
+			state = StateReady
+		}
+		switch state {
+		case StateReady:
+			stats.Ready++
+			if job.Pri < 1024 {
+				stats.Urgent++
+			}
+		case StateDelayed:
+			stats.Delayed++
+		case StateReserved:
+			stats.Reserved++
+		case StateBuried:
+			stats.Buried++
+		}
+	}
+	return stats, nil
+}
+
+// Close 内存队列没有连接需要关闭
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (m *Memory) reserved(id uint64) (*memoryJob, bool) {
+	job, ok := m.jobs[id]
+	if !ok || job.state != StateReserved || !job.until.After(time.Now()) {
+		return nil, false
+	}
+	return job, true
+}
+
+func (m *Memory) delay(job *memoryJob, delay time.Duration) {
+	if delay > 0 {
+		job.state = StateDelayed
+		job.until = time.Now().Add(delay)
+	} else {
+		job.state = StateReady
+	}
+}
+
+func (m *Memory) broadcast() {
+	close(m.notify)
+	m.notify = make(chan struct{})
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+package mq
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lfun125/gotool/logger"
+	"github.com/lfun125/gotool/logger/loggertest"
+)
+
+// runConsumer 后台运行 c, 测试结束时停止并等待 Run 返回
+func runConsumer(t *testing.T, c *Consumer) {
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run()
+	}()
+	t.Cleanup(func() {
+		c.Close()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Error(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("consumer not stopped")
+		}
+	})
+}
+
+func TestMemory_Priority(t *testing.T) {
+	m := NewMemory()
+	m.Put("a", []byte("low"), 10, 0, time.Minute)
+	m.Put("a", []byte("high"), 1, 0, time.Minute)
+	m.Put("b", []byte("other"), 0, 0, time.Minute)
+	job, err := m.Reserve(time.Second, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(job.Body) != "high" || job.Tube != "a" || job.Reserves != 1 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+}
+
+func TestMemory_Delay(t *testing.T) {
+	m := NewMemory()
+	m.Put("a", []byte("1"), 0, 200*time.Millisecond, time.Minute)
+	if _, err := m.Reserve(50*time.Millisecond, "a"); err != ErrTimeout {
+		t.Fatalf("expect timeout, got %v", err)
+	}
+	if _, err := m.Reserve(time.Second, "a"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemory_TTR(t *testing.T) {
+	m := NewMemory()
+	id, _ := m.Put("a", []byte("1"), 0, 0, time.Second)
+	if _, err := m.Reserve(time.Second, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Touch(id); err != nil {
+		t.Fatal(err)
+	}
+	job, err := m.Reserve(2*time.Second, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Reserves != 2 {
+		t.Fatalf("expect job to be reserved again after ttr, got %+v", job)
+	}
+	if err := m.Bury(id, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Release(id, 0, 0); err != ErrNotFound {
+		t.Fatalf("expect not found, got %v", err)
+	}
+}
+
+func TestConsumer_Subscribe(t *testing.T) {
+	m := NewMemory()
+	m.Put("a", []byte("1"), 0, 0, time.Minute)
+	done := make(chan uint64)
+	c := NewConsumer(m.Dial, "test", nil)
+	c.Handle("a", func(item *Item) (time.Duration, bool, error) {
+		done <- item.ID
+		return 0, true, nil
+	}, 1)
+	runConsumer(t, c)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job not consumed")
+	}
+}
+
+func TestConsumer_Handle(t *testing.T) {
+	m := NewMemory()
+	for i := 0; i < 4; i++ {
+		m.Put("a", []byte("a"), 0, 0, time.Minute)
+		m.Put("b", []byte("b"), 0, 0, time.Minute)
+	}
+	var mu sync.Mutex
+	var inflight, peak int
+	done := make(chan string, 8)
+	slow := func(item *Item) (time.Duration, bool, error) {
+		mu.Lock()
+		inflight++
+		if inflight > peak {
+			peak = inflight
+		}
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		inflight--
+		mu.Unlock()
+		done <- item.Tube
+		return 0, true, nil
+	}
+	c := NewConsumer(m.Dial, "test", nil)
+	c.Handle("a", slow, 1)
+	c.Handle("b", func(item *Item) (time.Duration, bool, error) {
+		done <- string(item.Body)
+		return 0, true, nil
+	}, 2)
+	runConsumer(t, c)
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		select {
+		case tube := <-done:
+			counts[tube]++
+		case <-time.After(2 * time.Second):
+			t.Fatalf("jobs not consumed: %v", counts)
+		}
+	}
+	if counts["a"] != 4 || counts["b"] != 4 {
+		t.Fatalf("unexpected dispatch %v", counts)
+	}
+	if peak != 1 {
+		t.Fatalf("tube a exceeded concurrency: %d", peak)
+	}
+}
+
+func TestConsumer_DialError(t *testing.T) {
+	m := NewMemory()
+	for i := 0; i < 4; i++ {
+		m.Put("a", []byte("1"), 0, 0, time.Minute)
+	}
+	var n int32
+	dial := func() (Queue, error) {
+		if atomic.AddInt32(&n, 1) == 3 {
+			return nil, errors.New("dial failed")
+		}
+		return m.Dial()
+	}
+	c := NewConsumer(dial, "test", nil)
+	c.Handle("a", func(item *Item) (time.Duration, bool, error) {
+		time.Sleep(10 * time.Millisecond)
+		return 0, true, nil
+	}, 3)
+	if err := c.Run(); err == nil || err.Error() != "dial failed" {
+		t.Fatalf("expect dial error, got %v", err)
+	}
+	if stats, _ := m.TubeStats("a"); stats.Reserved != 0 {
+		t.Fatalf("jobs left reserved after Run returned: %+v", stats)
+	}
+}
+
+func TestConsumer_Close(t *testing.T) {
+	m := NewMemory()
+	c := NewConsumer(m.Dial, "test", nil)
+	c.Handle("a", func(item *Item) (time.Duration, bool, error) {
+		return 0, true, nil
+	}, 2)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	c.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run not returned after Close")
+	}
+	m.Put("a", []byte("1"), 0, 0, time.Minute)
+	if stats, _ := m.TubeStats("a"); stats.Ready != 1 {
+		t.Fatalf("job reserved after Close: %+v", stats)
+	}
+}
+
+func TestConsumer_HandleNoExtraReserve(t *testing.T) {
+	m := NewMemory()
+	reserves := make(chan int, 5)
+	c := NewConsumer(m.Dial, "test", nil)
+	c.Handle("a", func(item *Item) (time.Duration, bool, error) {
+		time.Sleep(10 * time.Millisecond)
+		reserves <- item.Reserves
+		return 0, true, nil
+	}, 1)
+	c.Handle("b", func(item *Item) (time.Duration, bool, error) {
+		return 0, true, nil
+	}, 4)
+	runConsumer(t, c)
+	// 所有连接都在等待时同时到达的任务
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		m.Put("a", []byte("a"), 0, 0, time.Minute)
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case n := <-reserves:
+			if n != 1 {
+				t.Fatalf("job reserved %d times, expect 1", n)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("jobs not consumed")
+		}
+	}
+}
+
+func TestConsumer_KeepAlive(t *testing.T) {
+	m := NewMemory()
+	m.Put("a", []byte("slow"), 0, 0, time.Second)
+	var calls int32
+	reserves := make(chan int, 2)
+	c := NewConsumer(m.Dial, "test", nil)
+	c.Handle("a", func(item *Item) (time.Duration, bool, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(1500 * time.Millisecond)
+		reserves <- item.Reserves
+		return 0, true, nil
+	}, 2)
+	runConsumer(t, c)
+	select {
+	case n := <-reserves:
+		if n != 1 {
+			t.Fatalf("expect Reserves == 1, got %d", n)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("job not consumed")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("job re-reserved while handler was running: %d calls", n)
+	}
+	if stats, _ := m.TubeStats("a"); stats.Ready+stats.Reserved != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestConsumer_Logger(t *testing.T) {
+	m := NewMemory()
+	id, _ := m.Put("a", []byte("1"), 0, 0, time.Minute)
+	rec := loggertest.New()
+	c := NewConsumer(m.Dial, "worker", rec, WithMiddleware(Logging()))
+	c.Handle("a", func(item *Item) (time.Duration, bool, error) {
+		item.Logger().Info("in handler")
+		return 0, true, nil
+	}, 1)
+	runConsumer(t, c)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rec.Filter(logger.InfoLevel, "job done")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("job not processed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	rec.AssertLogged(t, logger.InfoLevel, "in handler", "tag", "worker", "tube", "a", "id", id)
+	rec.AssertLogged(t, logger.InfoLevel, "job done", "tag", "worker", "tube", "a", "id", id, "delete", true)
+
+	rec = loggertest.New()
+	p := NewProducer(func() (Queue, error) {
+		return nil, errors.New("dial failed")
+	}, "api", rec)
+	if _, err := p.Put("b", []byte("1"), 0, 0, time.Minute); err == nil {
+		t.Fatal("expect dial error")
+	}
+	rec.AssertLogged(t, logger.ErrorLevel, "queue dial error", "producer", "api", "tube", "b")
+}
@@ -0,0 +1,225 @@
+package mq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Action 任务处理后的去向
+type Action string
+
+const (
+	ActionDelete  Action = "delete"
+	ActionRelease Action = "release"
+	ActionBury    Action = "bury"
+)
+
+// Metrics 消费者指标
+type Metrics interface {
+	// JobHandled 处理函数返回后调用, err 为处理函数返回的错误
+	JobHandled(tube string, action Action, err error, latency time.Duration)
+	InFlight(tube string, delta int)
+	Backlog(tube string, ready, delayed int)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) JobHandled(string, Action, error, time.Duration) {}
+func (nopMetrics) InFlight(string, int)                            {}
+func (nopMetrics) Backlog(string, int, int)                        {}
+
+// DefaultBuckets 处理耗时直方图的默认分桶, 单位秒
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// TubeMetrics 单个 tube 的指标快照
+type TubeMetrics struct {
+	Processed    int64
+	Failed       int64
+	Deleted      int64
+	Released     int64
+	Buried       int64
+	InFlight     int64
+	Ready        int64
+	Delayed      int64
+	LatencyCount int64
+	LatencySum   float64
+	Buckets      []int64
+}
+
+// Registry 内存中的 Metrics 实现, 可按 Prometheus 文本格式输出
+type Registry struct {
+	mu      sync.Mutex
+	buckets []float64
+	tubes   map[string]*TubeMetrics
+}
+
+func NewRegistry(buckets ...float64) *Registry {
+	r := &Registry{}
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	r.buckets = append([]float64(nil), buckets...)
+	sort.Float64s(r.buckets)
+	r.tubes = map[string]*TubeMetrics{}
+	return r
+}
+
+func (r *Registry) tube(tube string) *TubeMetrics {
+	m, ok := r.tubes[tube]
+	if !ok {
+		m = &TubeMetrics{Buckets: make([]int64, len(r.buckets))}
+		r.tubes[tube] = m
+	}
+	return m
+}
+
+func (r *Registry) JobHandled(tube string, action Action, err error, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.tube(tube)
+	m.Processed++
+	if err != nil {
+		m.Failed++
+	}
+	switch action {
+	case ActionDelete:
+		m.Deleted++
+	case ActionRelease:
+		m.Released++
+	case ActionBury:
+		m.Buried++
+	}
+	seconds := latency.Seconds()
+	m.LatencyCount++
+	m.LatencySum += seconds
+	for i, le := range r.buckets {
+		if seconds <= le {
+			m.Buckets[i]++
+		}
+	}
+}
+
+func (r *Registry) InFlight(tube string, delta int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tube(tube).InFlight += int64(delta)
+}
+
+func (r *Registry) Backlog(tube string, ready, delayed int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.tube(tube)
+	m.Ready = int64(ready)
+	m.Delayed = int64(delayed)
+}
+
+// Tube 返回 tube 的指标快照
+func (r *Registry) Tube(tube string) TubeMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := *r.tube(tube)
+	m.Buckets = append([]int64(nil), m.Buckets...)
+	return m
+}
+
+// WritePrometheus 以 Prometheus 文本格式输出全部指标
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.tubes))
+	for name := range r.tubes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	counters := []struct {
+		name, help, typ string
+		value           func(m *TubeMetrics) int64
+	}{
+		{"mq_jobs_processed_total", "Jobs handled by the consumer.", "counter", func(m *TubeMetrics) int64 { return m.Processed }},
+		{"mq_jobs_failed_total", "Jobs whose handler returned an error.", "counter", func(m *TubeMetrics) int64 { return m.Failed }},
+		{"mq_jobs_deleted_total", "Jobs deleted after handling.", "counter", func(m *TubeMetrics) int64 { return m.Deleted }},
+		{"mq_jobs_released_total", "Jobs released after handling.", "counter", func(m *TubeMetrics) int64 { return m.Released }},
+		{"mq_jobs_buried_total", "Jobs buried after handling.", "counter", func(m *TubeMetrics) int64 { return m.Buried }},
+		{"mq_jobs_in_flight", "Jobs currently being handled.", "gauge", func(m *TubeMetrics) int64 { return m.InFlight }},
+		{"mq_tube_jobs_ready", "Ready jobs in the tube.", "gauge", func(m *TubeMetrics) int64 { return m.Ready }},
+		{"mq_tube_jobs_delayed", "Delayed jobs in the tube.", "gauge", func(m *TubeMetrics) int64 { return m.Delayed }},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", c.name, c.help, c.name, c.typ)
+		for _, name := range names {
+			fmt.Fprintf(bw, "%s{tube=\"%s\"} %d\n", c.name, escapeLabel(name), c.value(r.tubes[name]))
+		}
+	}
+	const hist = "mq_job_duration_seconds"
+	fmt.Fprintf(bw, "# HELP %s Handler latency.\n# TYPE %s histogram\n", hist, hist)
+	for _, name := range names {
+		m := r.tubes[name]
+		label := escapeLabel(name)
+		for i, le := range r.buckets {
+			fmt.Fprintf(bw, "%s_bucket{tube=\"%s\",le=\"%g\"} %d\n", hist, label, le, m.Buckets[i])
+		}
+		fmt.Fprintf(bw, "%s_bucket{tube=\"%s\",le=\"+Inf\"} %d\n", hist, label, m.LatencyCount)
+		fmt.Fprintf(bw, "%s_sum{tube=\"%s\"} %g\n", hist, label, m.LatencySum)
+		fmt.Fprintf(bw, "%s_count{tube=\"%s\"} %d\n", hist, label, m.LatencyCount)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := r.WritePrometheus(w); err != nil {
+		log.With("err", err).Error("mq.Registry.WritePrometheus")
+	}
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+// TubeStatter Admin 和 Memory 都实现了该接口
+type TubeStatter interface {
+	TubeStats(tube string) (*TubeStats, error)
+}
+
+// PollBacklog 每隔 interval 采样 tube 的 ready/delayed 数量, 返回的函数用于停止
+func PollBacklog(s TubeStatter, m Metrics, interval time.Duration, tubes ...string) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	poll := func() {
+		for _, tube := range tubes {
+			stats, err := s.TubeStats(tube)
+			if err == ErrNotFound {
+				m.Backlog(tube, 0, 0)
+				continue
+			} else if err != nil {
+				log.With("err", err, "tube", tube).Error("mq.PollBacklog")
+				continue
+			}
+			m.Backlog(tube, stats.Ready, stats.Delayed)
+		}
+	}
+	go func() {
+		defer ticker.Stop()
+		poll()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				poll()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
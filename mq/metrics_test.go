@@ -0,0 +1,47 @@
+package mq
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_WritePrometheus(t *testing.T) {
+	r := NewRegistry(0.1, 1)
+	r.JobHandled("a", ActionDelete, nil, 50*time.Millisecond)
+	r.JobHandled("a", ActionRelease, errors.New("x"), 500*time.Millisecond)
+	r.InFlight("a", 1)
+	r.Backlog("a", 3, 2)
+	var buf bytes.Buffer
+	if err := r.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`mq_jobs_processed_total{tube="a"} 2`,
+		`mq_jobs_failed_total{tube="a"} 1`,
+		`mq_jobs_released_total{tube="a"} 1`,
+		`mq_jobs_in_flight{tube="a"} 1`,
+		`mq_tube_jobs_ready{tube="a"} 3`,
+		`mq_job_duration_seconds_bucket{tube="a",le="0.1"} 1`,
+		`mq_job_duration_seconds_bucket{tube="a",le="+Inf"} 2`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Fatalf("missing %q in:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestPollBacklog(t *testing.T) {
+	m := NewMemory()
+	m.Put("a", []byte("1"), 0, 0, time.Minute)
+	m.Put("a", []byte("2"), 0, time.Hour, time.Minute)
+	r := NewRegistry()
+	stop := PollBacklog(m, r, time.Hour, "a")
+	defer stop()
+	time.Sleep(50 * time.Millisecond)
+	if s := r.Tube("a"); s.Ready != 1 || s.Delayed != 1 {
+		t.Fatalf("unexpected backlog %+v", s)
+	}
+}
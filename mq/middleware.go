@@ -0,0 +1,76 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lfun125/gotool/run"
+)
+
+// Middleware 包装 ProcessFunc
+type Middleware func(next ProcessFunc) ProcessFunc
+
+// Chain 组合多个中间件, 第一个在最外层
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next ProcessFunc) ProcessFunc {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// Recover 捕获处理函数的 panic 并记录日志, 任务按重试策略 release
+func Recover() Middleware {
+	return func(next ProcessFunc) ProcessFunc {
+		return func(item *Item) (delay time.Duration, isDel bool, err error) {
+			defer func() {
+				if e := recover(); e != nil {
+					item.Logger().With("track_list", run.Tracks()).Error("panic", e)
+					delay, isDel, err = 0, false, fmt.Errorf("panic: %v", e)
+				}
+			}()
+			return next(item)
+		}
+	}
+}
+
+// Timeout 处理超过 d 时取消 item.Context(), 等待处理函数返回后任务按重试策略 release;
+// 处理函数需要自行响应 Context, 返回之前任务仍会续期 TTR, 不会与下一个任务并发使用连接
+func Timeout(d time.Duration) Middleware {
+	return func(next ProcessFunc) ProcessFunc {
+		return func(item *Item) (time.Duration, bool, error) {
+			ctx, cancel := context.WithTimeout(item.Context(), d)
+			defer cancel()
+			item.SetContext(ctx)
+			delay, isDel, err := next(item)
+			if ctx.Err() == context.DeadlineExceeded {
+				return 0, false, fmt.Errorf("mq: job %d timed out after %s", item.ID, d)
+			}
+			return delay, isDel, err
+		}
+	}
+}
+
+// Logging 使用 item.Logger() 记录每个任务的处理结果和耗时
+func Logging() Middleware {
+	return func(next ProcessFunc) ProcessFunc {
+		return func(item *Item) (delay time.Duration, isDel bool, err error) {
+			start := time.Now()
+			delay, isDel, err = next(item)
+			entry := item.Logger().With(
+				"reserves", item.Reserves,
+				"latency", time.Since(start).String(),
+				"delete", isDel,
+				"delay", delay.String(),
+			)
+			if err != nil {
+				entry.With("err", err).Error("job failed")
+			} else {
+				entry.Info("job done")
+			}
+			return
+		}
+	}
+}
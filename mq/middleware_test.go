@@ -0,0 +1,59 @@
+package mq
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next ProcessFunc) ProcessFunc {
+			return func(item *Item) (time.Duration, bool, error) {
+				order = append(order, name)
+				return next(item)
+			}
+		}
+	}
+	do := Chain(mw("a"), mw("b"))(func(item *Item) (time.Duration, bool, error) {
+		order = append(order, "do")
+		return 0, true, nil
+	})
+	do(&Item{})
+	if strings.Join(order, ",") != "a,b,do" {
+		t.Fatalf("unexpected order %v", order)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	_, isDel, err := Recover()(func(item *Item) (time.Duration, bool, error) {
+		panic("boom")
+	})(&Item{})
+	if isDel || err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expect release with error, got %v %v", isDel, err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	var returned bool
+	_, isDel, err := Timeout(20 * time.Millisecond)(func(item *Item) (time.Duration, bool, error) {
+		<-item.Context().Done()
+		time.Sleep(20 * time.Millisecond)
+		returned = true
+		return 0, true, nil
+	})(&Item{})
+	if isDel || err == nil {
+		t.Fatalf("expect timeout error, got %v %v", isDel, err)
+	}
+	// 等待处理函数返回后才结束任务
+	if !returned {
+		t.Fatal("expect handler returned before settle")
+	}
+	_, isDel, err = Timeout(time.Second)(func(item *Item) (time.Duration, bool, error) {
+		return 0, true, nil
+	})(&Item{})
+	if !isDel || err != nil {
+		t.Fatalf("expect handler result, got %v %v", isDel, err)
+	}
+}
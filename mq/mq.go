@@ -1,16 +1,15 @@
 package mq
 
 import (
-	"strings"
+	"context"
 	"sync"
 	"time"
 
-	"github.com/kr/beanstalk"
 	"github.com/lfun125/gotool/logger"
-	"github.com/lfun125/gotool/run"
 )
 
-var log logger.Interface
+// log 包级函数 (Put/Subscribe/Admin 等) 使用的默认日志, Consumer/Producer 使用各自的日志
+var log = logger.NewNop()
 
 type Data struct {
 	Error chan error
@@ -18,35 +17,95 @@ type Data struct {
 }
 
 type Item struct {
-	Body []byte
-	ID   uint64
-	Conn *beanstalk.Conn
-	Wait sync.WaitGroup
+	Body     []byte
+	ID       uint64
+	Tube     string
+	Pri      uint32
+	TTR      time.Duration
+	Reserves int
+	Queue    Queue
+	Wait     sync.WaitGroup
+	ctx      context.Context
+	log      logger.Interface
 }
 
-func newData() *Data {
+// Logger 带有 tube/tag/id 字段的日志
+func (item *Item) Logger() logger.Interface {
+	if item.log == nil {
+		return log.With("tube", item.Tube, "id", item.ID)
+	}
+	return item.log
+}
+
+// Context 任务的上下文, 可通过 logger.FromContext 获取任务的 logger
+func (item *Item) Context() context.Context {
+	if item.ctx == nil {
+		return logger.WithContext(context.Background(), item.Logger())
+	}
+	return item.ctx
+}
+
+// SetContext 供中间件替换任务的上下文
+func (item *Item) SetContext(ctx context.Context) {
+	item.ctx = ctx
+}
+
+// Touch 延长任务的 TTR, 处理时间较长的任务可以主动调用
+func (item *Item) Touch() error {
+	return item.Queue.Touch(item.ID)
+}
+
+// keepAlive 每隔半个 TTR 自动 touch 任务, 返回的函数用于停止
+func (item *Item) keepAlive() (stop func()) {
+	if item.TTR <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	ticker := time.NewTicker(item.TTR / 2)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := item.Touch(); err != nil {
+					item.Logger().With("err", err).Error("queue.Touch")
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+func newData(size int) *Data {
 	data := &Data{}
-	data.Error = make(chan error)
+	data.Error = make(chan error, size)
 	data.Item = make(chan *Item)
 	return data
 }
 
-func SetLogger(logger logger.Interface) {
-	log = logger
+// SetLogger 设置包级函数使用的默认日志, nil 表示不记录
+func SetLogger(l logger.Interface) {
+	if l == nil {
+		l = logger.NewNop()
+	}
+	log = l
 }
 
 func Put(addr string, data []byte, key string, pri uint32, delay, trr time.Duration) (id uint64, err error) {
-	var conn *beanstalk.Conn
-	if conn, err = beanstalk.Dial("tcp", addr); err != nil {
+	var q Queue
+	if q, err = Beanstalk(addr)(); err != nil {
 		return
 	}
 	defer func() {
-		if err := conn.Close(); err != nil {
+		if err := q.Close(); err != nil {
 			log.Error(err)
 		}
 	}()
-	tube := beanstalk.Tube{Conn: conn, Name: key}
-	id, err = tube.Put(data, pri, delay, trr)
+	id, err = q.Put(key, data, pri, delay, trr)
 	return
 }
 
@@ -58,91 +117,29 @@ func PutAt(addr string, data []byte, key string, pri uint32, t time.Time, trr ti
 	return Put(addr, data, key, pri, delay, trr)
 }
 
-func Subscribe(addr, tube, tag string, do ProcessFunc) (err error) {
-	data := newData()
-	if err = watch(addr, tube, tag, data); err != nil {
-		return
-	}
-	for {
-		select {
-		case err = <-data.Error:
-			return
-		case item := <-data.Item:
-			process(item, do)
-		}
-	}
+func Subscribe(addr, tube, tag string, do ProcessFunc, options ...Option) (err error) {
+	return NewConsumer(Beanstalk(addr), tag, log, options...).Subscribe(tube, do)
 }
 
-func watch(addr, tube, tag string, data *Data) (err error) {
-	var conn *beanstalk.Conn
-	if conn, err = beanstalk.Dial("tcp", addr); err != nil {
-		return
+func (item *Item) delete() {
+	item.Logger().Info("queue delete")
+	if err := item.Queue.Delete(item.ID); err != nil {
+		item.Logger().With("err", err).Error("queue.Delete")
 	}
-	tubeSet := beanstalk.NewTubeSet(conn, tube)
-	run.GO(log, func() {
-		defer func() {
-			if err := conn.Close(); err != nil {
-				log.Error(err)
-			}
-		}()
-		for {
-			id, body, err := tubeSet.Reserve(30 * time.Minute)
-			if err != nil && strings.HasPrefix(err.Error(), "reserve-with-timeout") {
-				continue
-			} else if err != nil {
-				log.With("tag", tag).With("err", err).Error("beanstalk reserve error")
-				data.Error <- err
-				return
-			}
-			bodyData := map[string]interface{}{
-				tag: string(body),
-			}
-			log.With("tag", tag).With("id", id, "body_data", bodyData).Info("reserve new message")
-			item := &Item{
-				Body: body,
-				ID:   id,
-				Conn: conn,
-				Wait: sync.WaitGroup{},
-			}
-			item.Wait.Add(1)
-			data.Item <- item
-			item.Wait.Wait()
-		}
-	}, 1)
-	return
 }
 
-func beanstalkDelete(conn *beanstalk.Conn, id uint64) {
-	log.With("id", id).Info("beanstalk delete")
-	if err := conn.Delete(id); err != nil {
-		log.With("err", err, "id", id).Error("beanstalk.Delete")
+func (item *Item) bury(pri uint32) {
+	item.Logger().With("pri", pri).Info("queue bury")
+	if err := item.Queue.Bury(item.ID, pri); err != nil {
+		item.Logger().With("err", err).Error("queue.Bury")
 	}
 }
 
-func beanstalkRelease(conn *beanstalk.Conn, id uint64, delay time.Duration) {
-	log.With("id", id, "delay", delay).Info("beanstalk release")
-	if err := conn.Release(id, 1024, delay); err != nil {
-		log.With("err", err, "id", id).Error("beanstalk.Release")
+func (item *Item) release(pri uint32, delay time.Duration) {
+	item.Logger().With("pri", pri, "delay", delay).Info("queue release")
+	if err := item.Queue.Release(item.ID, pri, delay); err != nil {
+		item.Logger().With("err", err).Error("queue.Release")
 	}
 }
 
 type ProcessFunc func(item *Item) (delay time.Duration, isDel bool, err error)
-
-func process(item *Item, f ProcessFunc) {
-	defer func() {
-		item.Wait.Done()
-	}()
-
-	delay, isDel, err := f(item)
-	if err != nil {
-		log.With("beanstalk.id", item.ID).Error(err)
-	}
-	if isDel {
-		beanstalkDelete(item.Conn, item.ID)
-	} else {
-		if err != nil && delay == 0 {
-			delay = 15 * time.Second
-		}
-		beanstalkRelease(item.Conn, item.ID, delay)
-	}
-}
@@ -0,0 +1,38 @@
+package mq
+
+type Option func(c *Consumer)
+
+// WithRetry 处理失败且未指定延迟时使用的重试策略, 默认固定 15 秒
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Consumer) {
+		c.retry = policy
+	}
+}
+
+// WithPriority release 时使用的优先级, 默认固定 1024
+func WithPriority(f PriorityFunc) Option {
+	return func(c *Consumer) {
+		c.priority = f
+	}
+}
+
+// WithMetrics 记录消费指标, 默认不记录
+func WithMetrics(m Metrics) Option {
+	return func(c *Consumer) {
+		c.metrics = m
+	}
+}
+
+// WithMiddleware 为所有处理函数添加中间件, 默认已包含 Recover
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(c *Consumer) {
+		c.chain = append(c.chain, middlewares...)
+	}
+}
+
+// WithBodyLog reserve 日志中消息体的记录方式, 默认只记录长度
+func WithBodyLog(f BodyFormat) Option {
+	return func(c *Consumer) {
+		c.bodyLog = f
+	}
+}
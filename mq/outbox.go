@@ -0,0 +1,381 @@
+package mq
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboxMessage 待投递的消息
+type OutboxMessage struct {
+	ID        int64         `json:"id"`
+	Tube      string        `json:"tube"`
+	Body      []byte        `json:"body"`
+	Pri       uint32        `json:"pri"`
+	Delay     time.Duration `json:"delay"`
+	TTR       time.Duration `json:"ttr"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// OutboxStore Relay 从中读取待投递消息, 投递成功后标记为已发送
+type OutboxStore interface {
+	// Pending 按 ID 顺序返回未发送的消息, limit 不大于 0 时返回全部
+	Pending(limit int) ([]*OutboxMessage, error)
+	MarkSent(id int64) error
+}
+
+type outboxRecord struct {
+	Op      string         `json:"op"`
+	ID      int64          `json:"id,omitempty"`
+	Message *OutboxMessage `json:"msg,omitempty"`
+}
+
+// compactSize 文件超过该大小且一半以上记录已失效时压缩
+const compactSize = 4 << 20
+
+// FileOutbox 基于追加写文件的 OutboxStore, Add 返回前数据已落盘
+type FileOutbox struct {
+	mu       sync.Mutex
+	filename string
+	file     *os.File
+	nextID   int64
+	pending  map[int64]*OutboxMessage
+	// size/records 当前文件的字节数和记录数
+	size        int64
+	records     int
+	compactSize int64
+}
+
+func OpenFileOutbox(filename string) (*FileOutbox, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	o := &FileOutbox{filename: filename, file: file, pending: map[int64]*OutboxMessage{}, compactSize: compactSize}
+	if err := o.replay(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+// replay 重建未发送消息, 丢弃崩溃时写了一半的最后一行
+func (o *FileOutbox) replay() error {
+	r := bufio.NewReader(o.file)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			o.size = offset
+			if len(line) > 0 {
+				return o.file.Truncate(offset)
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+		record := &outboxRecord{}
+		if err := json.Unmarshal(line, record); err != nil {
+			return fmt.Errorf("mq: corrupt outbox record at offset %d: %w", offset, err)
+		}
+		switch record.Op {
+		case "add":
+			if record.Message == nil {
+				return fmt.Errorf("mq: corrupt outbox record at offset %d: missing msg", offset)
+			}
+			o.pending[record.Message.ID] = record.Message
+			if record.Message.ID > o.nextID {
+				o.nextID = record.Message.ID
+			}
+		case "sent":
+			delete(o.pending, record.ID)
+		}
+		o.records++
+		offset += int64(len(line))
+	}
+}
+
+func (o *FileOutbox) Add(tube string, body []byte, pri uint32, delay, ttr time.Duration) (id int64, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	msg := &OutboxMessage{
+		ID:        o.nextID + 1,
+		Tube:      tube,
+		Body:      body,
+		Pri:       pri,
+		Delay:     delay,
+		TTR:       ttr,
+		CreatedAt: time.Now(),
+	}
+	if err = o.write(&outboxRecord{Op: "add", Message: msg}); err != nil {
+		return
+	}
+	o.nextID = msg.ID
+	o.pending[msg.ID] = msg
+	return msg.ID, nil
+}
+
+func (o *FileOutbox) Pending(limit int) ([]*OutboxMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	list := make([]*OutboxMessage, 0, len(o.pending))
+	for _, msg := range o.pending {
+		list = append(list, msg)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+// MarkSent 全部消息发送完成后清空文件, 文件较大且大部分记录已失效时只保留未发送的消息
+func (o *FileOutbox) MarkSent(id int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.pending[id]; !ok {
+		return nil
+	}
+	if len(o.pending) == 1 {
+		if err := o.file.Truncate(0); err != nil {
+			return err
+		}
+		delete(o.pending, id)
+		o.size = 0
+		o.records = 0
+		return o.file.Sync()
+	}
+	if err := o.write(&outboxRecord{Op: "sent", ID: id}); err != nil {
+		return err
+	}
+	delete(o.pending, id)
+	if o.size >= o.compactSize && o.records >= 2*len(o.pending) {
+		return o.compact()
+	}
+	return nil
+}
+
+// compact 将未发送的消息写入临时文件后替换原文件
+func (o *FileOutbox) compact() (err error) {
+	tmp := o.filename + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(tmp)
+		}
+	}()
+	list := make([]*OutboxMessage, 0, len(o.pending))
+	for _, msg := range o.pending {
+		list = append(list, msg)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	w := bufio.NewWriter(file)
+	var size int64
+	for _, msg := range list {
+		var raw []byte
+		if raw, err = json.Marshal(&outboxRecord{Op: "add", Message: msg}); err != nil {
+			return
+		}
+		if _, err = w.Write(append(raw, '\n')); err != nil {
+			return
+		}
+		size += int64(len(raw)) + 1
+	}
+	if err = w.Flush(); err != nil {
+		return
+	}
+	if err = file.Sync(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp, o.filename); err != nil {
+		return
+	}
+	o.file.Close()
+	o.file = file
+	o.size = size
+	o.records = len(list)
+	return nil
+}
+
+func (o *FileOutbox) Close() error {
+	return o.file.Close()
+}
+
+func (o *FileOutbox) write(record *outboxRecord) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := o.file.Write(append(raw, '\n')); err != nil {
+		return err
+	}
+	o.size += int64(len(raw)) + 1
+	o.records++
+	return o.file.Sync()
+}
+
+// Execer *sql.DB 和 *sql.Tx 都实现了该接口
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Placeholder 生成第 n 个 (从 1 开始) 参数占位符
+type Placeholder func(n int) string
+
+var (
+	QuestionPlaceholder Placeholder = func(int) string { return "?" }
+	DollarPlaceholder   Placeholder = func(n int) string { return fmt.Sprintf("$%d", n) }
+)
+
+// SQLOutbox 基于数据库表的 OutboxStore, 表结构:
+//
+//	CREATE TABLE mq_outbox (
+//	    id         BIGINT PRIMARY KEY AUTO_INCREMENT,
+//	    tube       VARCHAR(200) NOT NULL,
+//	    body       BLOB NOT NULL,
+//	    pri        BIGINT NOT NULL,
+//	    delay_ms   BIGINT NOT NULL,
+//	    ttr_ms     BIGINT NOT NULL,
+//	    created_at BIGINT NOT NULL,
+//	    sent_at    BIGINT NULL
+//	);
+//
+// created_at/sent_at 为毫秒时间戳
+type SQLOutbox struct {
+	db          *sql.DB
+	table       string
+	placeholder Placeholder
+}
+
+func NewSQLOutbox(db *sql.DB, table string, placeholder Placeholder) *SQLOutbox {
+	return &SQLOutbox{db: db, table: table, placeholder: placeholder}
+}
+
+// Add 在调用方的事务中写入消息
+func (o *SQLOutbox) Add(tx Execer, tube string, body []byte, pri uint32, delay, ttr time.Duration) error {
+	query := fmt.Sprintf(
+		"INSERT INTO %s (tube, body, pri, delay_ms, ttr_ms, created_at) VALUES (%s)",
+		o.table, o.placeholders(1, 6),
+	)
+	_, err := tx.Exec(query, tube, body, int64(pri), delay.Milliseconds(), ttr.Milliseconds(), time.Now().UnixMilli())
+	return err
+}
+
+func (o *SQLOutbox) Pending(limit int) (list []*OutboxMessage, err error) {
+	query := fmt.Sprintf(
+		"SELECT id, tube, body, pri, delay_ms, ttr_ms, created_at FROM %s WHERE sent_at IS NULL ORDER BY id",
+		o.table,
+	)
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	var rows *sql.Rows
+	if rows, err = o.db.Query(query); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pri, delay, ttr, createdAt int64
+		msg := &OutboxMessage{}
+		if err = rows.Scan(&msg.ID, &msg.Tube, &msg.Body, &pri, &delay, &ttr, &createdAt); err != nil {
+			return
+		}
+		msg.Pri = uint32(pri)
+		msg.Delay = time.Duration(delay) * time.Millisecond
+		msg.TTR = time.Duration(ttr) * time.Millisecond
+		msg.CreatedAt = time.UnixMilli(createdAt)
+		list = append(list, msg)
+	}
+	err = rows.Err()
+	return
+}
+
+func (o *SQLOutbox) MarkSent(id int64) error {
+	query := fmt.Sprintf("UPDATE %s SET sent_at = %s WHERE id = %s", o.table, o.placeholder(1), o.placeholder(2))
+	_, err := o.db.Exec(query, time.Now().UnixMilli(), id)
+	return err
+}
+
+func (o *SQLOutbox) placeholders(from, n int) string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = o.placeholder(from + i)
+	}
+	return strings.Join(list, ", ")
+}
+
+// Relay 将 OutboxStore 中的消息通过 Producer 投递到队列, 至少投递一次
+type Relay struct {
+	store    OutboxStore
+	producer *Producer
+	interval time.Duration
+	batch    int
+}
+
+func NewRelay(store OutboxStore, producer *Producer, interval time.Duration) *Relay {
+	return &Relay{store: store, producer: producer, interval: interval, batch: 100}
+}
+
+// Flush 投递当前全部待发送消息
+func (r *Relay) Flush() (n int, err error) {
+	for {
+		var list []*OutboxMessage
+		if list, err = r.store.Pending(r.batch); err != nil || len(list) == 0 {
+			return
+		}
+		for _, msg := range list {
+			// 扣除消息在 outbox 中停留的时间
+			delay := msg.Delay - time.Since(msg.CreatedAt)
+			if delay < 0 {
+				delay = 0
+			}
+			if _, err = r.producer.Put(msg.Tube, msg.Body, msg.Pri, delay, msg.TTR); err != nil {
+				return
+			}
+			if err = r.store.MarkSent(msg.ID); err != nil {
+				return
+			}
+			n++
+		}
+	}
+}
+
+// Start 每隔 interval 执行一次 Flush, 返回的函数用于停止
+func (r *Relay) Start() (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	ticker := time.NewTicker(r.interval)
+	go func() {
+		defer close(exited)
+		defer ticker.Stop()
+		for {
+			if n, err := r.Flush(); err != nil {
+				r.producer.log.With("err", err, "sent", n).Error("mq.Relay.Flush")
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
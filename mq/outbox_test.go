@@ -0,0 +1,91 @@
+package mq
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileOutbox_Relay(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "outbox.log")
+	o, err := OpenFileOutbox(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Add("a", []byte("1"), 0, 0, time.Minute)
+	o.Add("a", []byte("2"), 0, 0, time.Minute)
+	o.Close()
+
+	// 模拟崩溃时写了一半的记录
+	f, _ := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"op":"add","msg":{"id":3`)
+	f.Close()
+
+	if o, err = OpenFileOutbox(filename); err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	m := NewMemory()
+	n, err := NewRelay(o, NewProducer(m.Dial, "test", nil), time.Second).Flush()
+	if err != nil || n != 2 {
+		t.Fatalf("expect 2 sent, got %d %v", n, err)
+	}
+	if stats, _ := m.TubeStats("a"); stats.Ready != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if list, _ := o.Pending(10); len(list) != 0 {
+		t.Fatalf("expect no pending, got %d", len(list))
+	}
+	if info, _ := os.Stat(filename); info.Size() != 0 {
+		t.Fatalf("expect outbox to be compacted, size %d", info.Size())
+	}
+}
+
+func TestFileOutbox_Compact(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "outbox.log")
+	o, err := OpenFileOutbox(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.compactSize = 1024
+	// 始终有未发送的消息, 文件不会被清空
+	o.Add("a", []byte("first"), 0, 0, time.Minute)
+	for i := 0; i < 100; i++ {
+		id, err := o.Add("a", []byte("x"), 0, 0, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := o.MarkSent(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last, _ := o.Add("a", []byte("last"), 0, 0, time.Minute)
+	o.Close()
+	if info, _ := os.Stat(filename); info.Size() > 2048 {
+		t.Fatalf("expect outbox to be compacted, size %d", info.Size())
+	}
+	if o, err = OpenFileOutbox(filename); err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	list, _ := o.Pending(10)
+	if len(list) != 2 || string(list[0].Body) != "first" || list[1].ID != last {
+		t.Fatalf("unexpected pending after compaction %+v", list)
+	}
+	if id, _ := o.Add("a", []byte("next"), 0, 0, time.Minute); id != last+1 {
+		t.Fatalf("expect id %d, got %d", last+1, id)
+	}
+}
+
+func TestFileOutbox_CorruptRecord(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "outbox.log")
+	for _, line := range []string{`{"op":"add"}`, `{"op":"add","msg":null}`} {
+		if err := os.WriteFile(filename, []byte(line+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenFileOutbox(filename); err == nil {
+			t.Fatalf("%s: expect error", line)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package mq
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lfun125/gotool/logger"
+	"google.golang.org/protobuf/proto"
+)
+
+// Producer 复用同一个连接投递消息, 连接出错时下次投递重新建立
+type Producer struct {
+	dial Dialer
+	name string
+	log  logger.Interface
+	mu   sync.Mutex
+	q    Queue
+}
+
+// NewProducer name 会写入信封的 Producer 字段, log 为 nil 时不记录日志
+func NewProducer(dial Dialer, name string, log logger.Interface) *Producer {
+	if log == nil {
+		log = logger.NewNop()
+	}
+	p := &Producer{}
+	p.dial = dial
+	p.name = name
+	p.log = log.With("producer", name)
+	return p
+}
+
+func (p *Producer) queue() (Queue, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.q == nil {
+		q, err := p.dial()
+		if err != nil {
+			return nil, err
+		}
+		p.q = q
+	}
+	return p.q, nil
+}
+
+// reset 关闭出错的连接
+func (p *Producer) reset(q Queue) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.q != q {
+		return
+	}
+	p.q = nil
+	if err := q.Close(); err != nil {
+		p.log.Error(err)
+	}
+}
+
+func (p *Producer) Put(tube string, body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
+	var q Queue
+	if q, err = p.queue(); err != nil {
+		p.log.With("err", err, "tube", tube).Error("queue dial error")
+		return
+	}
+	if id, err = q.Put(tube, body, pri, delay, ttr); err != nil {
+		p.log.With("err", err, "tube", tube).Error("queue.Put")
+		p.reset(q)
+	}
+	return
+}
+
+func (p *Producer) PutAt(tube string, body []byte, pri uint32, t time.Time, ttr time.Duration) (id uint64, err error) {
+	delay := time.Until(t)
+	if delay < 0 {
+		delay = 0
+	}
+	return p.Put(tube, body, pri, delay, ttr)
+}
+
+func (p *Producer) PutJSON(tube string, v interface{}, pri uint32, delay, ttr time.Duration, options ...EnvelopeOption) (id uint64, err error) {
+	var body []byte
+	if body, err = Marshal(JSON, v, append([]EnvelopeOption{WithProducer(p.name)}, options...)...); err != nil {
+		return
+	}
+	return p.Put(tube, body, pri, delay, ttr)
+}
+
+func (p *Producer) PutProto(tube string, m proto.Message, pri uint32, delay, ttr time.Duration, options ...EnvelopeOption) (id uint64, err error) {
+	var body []byte
+	if body, err = Marshal(Proto, m, append([]EnvelopeOption{WithProducer(p.name)}, options...)...); err != nil {
+		return
+	}
+	return p.Put(tube, body, pri, delay, ttr)
+}
+
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.q == nil {
+		return nil
+	}
+	err := p.q.Close()
+	p.q = nil
+	return err
+}
@@ -0,0 +1,39 @@
+package mq
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrTimeout Reserve 在超时时间内没有可用任务
+	ErrTimeout = errors.New("mq: reserve timeout")
+	// ErrNotFound 任务不存在或不处于该操作要求的状态
+	ErrNotFound = errors.New("mq: job not found")
+	// ErrClosed 连接已关闭
+	ErrClosed = errors.New("mq: connection closed")
+)
+
+// Job 被 reserve 的任务
+type Job struct {
+	ID       uint64
+	Tube     string
+	Body     []byte
+	Pri      uint32
+	TTR      time.Duration
+	Reserves int
+}
+
+// Queue 队列连接, Delete/Release/Bury/Touch 只能作用于同一连接 reserve 的任务
+type Queue interface {
+	Put(tube string, body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error)
+	Reserve(timeout time.Duration, tubes ...string) (*Job, error)
+	Delete(id uint64) error
+	Release(id uint64, pri uint32, delay time.Duration) error
+	Bury(id uint64, pri uint32) error
+	Touch(id uint64) error
+	Close() error
+}
+
+// Dialer 创建新的队列连接
+type Dialer func() (Queue, error)
@@ -0,0 +1,85 @@
+package mq
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy 根据任务的第几次投递 (从 1 开始) 计算失败后 release 的延迟
+type RetryPolicy interface {
+	Delay(attempt int) time.Duration
+}
+
+type RetryFunc func(attempt int) time.Duration
+
+func (f RetryFunc) Delay(attempt int) time.Duration {
+	return f(attempt)
+}
+
+// FixedRetry 固定延迟
+func FixedRetry(delay time.Duration) RetryPolicy {
+	return RetryFunc(func(attempt int) time.Duration {
+		return delay
+	})
+}
+
+// ExponentialRetry base * 2^(attempt-1), 最大为 max
+func ExponentialRetry(base, max time.Duration) RetryPolicy {
+	return RetryFunc(func(attempt int) time.Duration {
+		return exponential(base, max, attempt)
+	})
+}
+
+// ExponentialJitterRetry 在 [0, base * 2^(attempt-1)] 之间随机取值, 最大为 max
+func ExponentialJitterRetry(base, max time.Duration) RetryPolicy {
+	return RetryFunc(func(attempt int) time.Duration {
+		d := exponential(base, max, attempt)
+		if d <= 0 {
+			return 0
+		}
+		return time.Duration(rand.Int63n(int64(d) + 1))
+	})
+}
+
+func exponential(base, max time.Duration, attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := float64(base) * math.Pow(2, float64(attempt-1))
+	if d > float64(max) {
+		return max
+	}
+	return time.Duration(d)
+}
+
+// PriorityFunc 计算 release 时任务的优先级, 数值越大优先级越低
+type PriorityFunc func(pri uint32, attempt int) uint32
+
+// FixedPriority 始终使用固定优先级
+func FixedPriority(pri uint32) PriorityFunc {
+	return func(uint32, int) uint32 {
+		return pri
+	}
+}
+
+// KeepPriority 保持任务原有优先级
+func KeepPriority() PriorityFunc {
+	return func(pri uint32, attempt int) uint32 {
+		return pri
+	}
+}
+
+// DecayPriority 每重试一次优先级数值增加 step
+func DecayPriority(step uint32) PriorityFunc {
+	return func(pri uint32, attempt int) uint32 {
+		if attempt < 1 {
+			return pri
+		}
+		n := uint64(pri) + uint64(step)*uint64(attempt)
+		if n > math.MaxUint32 {
+			return math.MaxUint32
+		}
+		return uint32(n)
+	}
+}
@@ -0,0 +1,32 @@
+package mq
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestExponentialRetry(t *testing.T) {
+	p := ExponentialRetry(time.Second, 10*time.Second)
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second} {
+		if d := p.Delay(attempt); d != want {
+			t.Fatalf("attempt %d: expect %s, got %s", attempt, want, d)
+		}
+	}
+	j := ExponentialJitterRetry(time.Second, 10*time.Second)
+	for i := 0; i < 100; i++ {
+		if d := j.Delay(3); d < 0 || d > 4*time.Second {
+			t.Fatalf("jitter out of range: %s", d)
+		}
+	}
+}
+
+func TestDecayPriority(t *testing.T) {
+	f := DecayPriority(10)
+	if pri := f(100, 3); pri != 130 {
+		t.Fatalf("expect 130, got %d", pri)
+	}
+	if pri := f(math.MaxUint32-1, 2); pri != math.MaxUint32 {
+		t.Fatalf("expect overflow to be capped, got %d", pri)
+	}
+}
@@ -0,0 +1,107 @@
+package mq
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	rpcPri = 1024
+	rpcTTR = time.Minute
+)
+
+// RemoteError 服务端处理函数返回的错误
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+// Call 使用默认日志和 beanstalkd 连接调用 Producer.Call
+func Call(ctx context.Context, addr, tube string, req, resp interface{}, options ...EnvelopeOption) error {
+	p := NewProducer(Beanstalk(addr), DefaultProducer, log)
+	defer func() {
+		if err := p.Close(); err != nil {
+			log.Error(err)
+		}
+	}()
+	return p.Call(ctx, tube, req, resp, options...)
+}
+
+// Call 向 tube 投递请求并等待响应解码到 resp, 直到 ctx 结束;
+// 每次调用使用单独的连接和唯一的响应 tube, ctx 结束后才到达的响应会留在响应 tube 中
+func (p *Producer) Call(ctx context.Context, tube string, req, resp interface{}, options ...EnvelopeOption) (err error) {
+	var q Queue
+	if q, err = p.dial(); err != nil {
+		return
+	}
+	defer func() {
+		if err := q.Close(); err != nil {
+			p.log.Error(err)
+		}
+	}()
+	replyTo := "reply." + newMessageID()
+	options = append([]EnvelopeOption{WithProducer(p.name), WithReplyTo(replyTo)}, options...)
+	var body []byte
+	if body, err = Marshal(JSON, req, options...); err != nil {
+		return
+	}
+	if _, err = q.Put(tube, body, rpcPri, 0, rpcTTR); err != nil {
+		return
+	}
+	for {
+		timeout := time.Second
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+			timeout = time.Until(deadline)
+		}
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		job, err := q.Reserve(timeout, replyTo)
+		if err == ErrTimeout {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := q.Delete(job.ID); err != nil {
+			p.log.With("err", err, "tube", replyTo, "id", job.ID).Error("queue.Delete")
+		}
+		e, err := Unmarshal(JSON, job.Body, resp)
+		if e != nil && e.Error != "" {
+			return &RemoteError{Message: e.Error}
+		}
+		return err
+	}
+}
+
+// Reply 将处理函数转换为 ProcessFunc, 处理结果 (包括错误) 投递到请求中的响应 tube 后删除请求;
+// 无法解码的请求会被 bury, 没有响应 tube 的请求处理后直接删除
+func Reply[Req, Resp any](do func(item *Item, req *Req) (*Resp, error)) ProcessFunc {
+	return func(item *Item) (delay time.Duration, isDel bool, err error) {
+		req := new(Req)
+		e, err := Unmarshal(JSON, item.Body, req)
+		if err != nil {
+			return 0, false, Bury(err)
+		}
+		resp, handleErr := do(item, req)
+		if e.ReplyTo == "" {
+			return 0, true, handleErr
+		}
+		options := []EnvelopeOption{WithType("reply"), WithCorrelationID(e.ID)}
+		if handleErr != nil {
+			options = append(options, func(e *Envelope) {
+				e.Error = handleErr.Error()
+			})
+		}
+		var body []byte
+		if body, err = Marshal(JSON, resp, options...); err != nil {
+			return 0, false, err
+		}
+		if _, err = item.Queue.Put(e.ReplyTo, body, rpcPri, 0, rpcTTR); err != nil {
+			return 0, false, err
+		}
+		return 0, true, handleErr
+	}
+}
@@ -0,0 +1,43 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCall(t *testing.T) {
+	type req struct{ A, B int }
+	type resp struct{ Sum int }
+	m := NewMemory()
+	c := NewConsumer(m.Dial, "test", nil)
+	c.Handle("sum", Reply(func(item *Item, r *req) (*resp, error) {
+		if r.A < 0 {
+			return nil, errors.New("negative")
+		}
+		return &resp{Sum: r.A + r.B}, nil
+	}), 1)
+	runConsumer(t, c)
+
+	p := NewProducer(m.Dial, "test", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	out := &resp{}
+	if err := p.Call(ctx, "sum", &req{A: 1, B: 2}, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Sum != 3 {
+		t.Fatalf("expect 3, got %d", out.Sum)
+	}
+	var remote *RemoteError
+	if err := p.Call(ctx, "sum", &req{A: -1}, out); !errors.As(err, &remote) || remote.Message != "negative" {
+		t.Fatalf("expect remote error, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Call(ctx, "nobody", &req{}, out); err != context.DeadlineExceeded {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+package mq
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lfun125/gotool/logger"
+)
+
+// ScheduleStore 记录定时任务上次投递的时间, 并通过租约保证多个 Scheduler 中只有一个投递
+type ScheduleStore interface {
+	// Acquire 获取或续期 name 的租约, 租约由其他 owner 持有且未过期时返回 false
+	Acquire(name, owner string, ttl time.Duration) (bool, error)
+	// Last 返回上次投递对应的计划时间, 从未投递时返回零值
+	Last(name string) (time.Time, error)
+	SetLast(name string, t time.Time) error
+}
+
+type task struct {
+	name     string
+	schedule Schedule
+	tube     string
+	body     func(at time.Time) ([]byte, error)
+	pri      uint32
+	ttr      time.Duration
+}
+
+// Scheduler 按 Schedule 定时投递任务, 重启后从上次投递的时间继续, 错过的每一次都会补投;
+// 投递成功但记录投递时间前退出或出错时, 同一次会再次投递, 消费者需按 ScheduleKey 去重 (见 AddJSON)
+type Scheduler struct {
+	producer *Producer
+	store    ScheduleStore
+	log      logger.Interface
+	owner    string
+	lease    time.Duration
+	interval time.Duration
+	mu       sync.Mutex
+	tasks    []*task
+}
+
+// NewScheduler log 为 nil 时不记录日志
+func NewScheduler(producer *Producer, store ScheduleStore, log logger.Interface) *Scheduler {
+	if log == nil {
+		log = logger.NewNop()
+	}
+	hostname, _ := os.Hostname()
+	s := &Scheduler{}
+	s.producer = producer
+	s.store = store
+	s.owner = fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), newMessageID()[:8])
+	s.log = log.With("scheduler", s.owner)
+	s.lease = 30 * time.Second
+	s.interval = time.Second
+	return s
+}
+
+// Add 按 schedule 向 tube 投递固定的 body
+func (s *Scheduler) Add(name string, schedule Schedule, tube string, body []byte, pri uint32, ttr time.Duration) {
+	s.AddFunc(name, schedule, tube, func(time.Time) ([]byte, error) {
+		return body, nil
+	}, pri, ttr)
+}
+
+// AddFunc 每次投递时调用 body 生成消息体, at 为本次的计划时间
+func (s *Scheduler) AddFunc(name string, schedule Schedule, tube string, body func(at time.Time) ([]byte, error), pri uint32, ttr time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks = append(s.tasks, &task{name: name, schedule: schedule, tube: tube, body: body, pri: pri, ttr: ttr})
+}
+
+// AddJSON 将 v 返回的值以 JSON 编码装入信封投递, 信封 ID 为 ScheduleKey,
+// 消费者使用 Dedup(store, nil) 即可去除同一次的重复投递
+func (s *Scheduler) AddJSON(name string, schedule Schedule, tube string, v func(at time.Time) (interface{}, error), pri uint32, ttr time.Duration) {
+	s.AddFunc(name, schedule, tube, func(at time.Time) ([]byte, error) {
+		value, err := v(at)
+		if err != nil {
+			return nil, err
+		}
+		return Marshal(JSON, value, WithID(ScheduleKey(name, at)))
+	}, pri, ttr)
+}
+
+// ScheduleKey 任务 name 在计划时间 at 的投递对应的确定键, 重复投递时不变
+func ScheduleKey(name string, at time.Time) string {
+	return fmt.Sprintf("%s@%d", name, at.UnixMilli())
+}
+
+// Start 每秒检查一次到期任务, 返回的函数用于停止
+func (s *Scheduler) Start() (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	ticker := time.NewTicker(s.interval)
+	go func() {
+		defer close(exited)
+		defer ticker.Stop()
+		for {
+			s.Tick(time.Now())
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// Tick 投递截至 now 所有到期的任务
+func (s *Scheduler) Tick(now time.Time) {
+	s.mu.Lock()
+	tasks := append([]*task(nil), s.tasks...)
+	s.mu.Unlock()
+	for _, t := range tasks {
+		if err := s.run(t, now); err != nil {
+			s.log.With("err", err, "task", t.name, "tube", t.tube).Error("schedule task error")
+		}
+	}
+}
+
+// maxCatchUp 每次 Tick 单个任务最多补投的次数
+const maxCatchUp = 100
+
+func (s *Scheduler) run(t *task, now time.Time) error {
+	ok, err := s.store.Acquire(t.name, s.owner, s.lease)
+	if err != nil || !ok {
+		return err
+	}
+	last, err := s.store.Last(t.name)
+	if err != nil {
+		return err
+	}
+	if last.IsZero() {
+		// 首次运行从当前时间开始计算
+		return s.store.SetLast(t.name, now)
+	}
+	for n, next := 0, t.schedule.Next(last); !next.IsZero() && !next.After(now); n, next = n+1, t.schedule.Next(next) {
+		if n >= maxCatchUp {
+			// 剩余的在下次 Tick 继续补投
+			break
+		}
+		if n > 0 {
+			// 每次投递前续期, 租约已被其他实例取得时停止
+			if ok, err := s.store.Acquire(t.name, s.owner, s.lease); err != nil || !ok {
+				return err
+			}
+		}
+		if !next.After(last) {
+			return fmt.Errorf("mq: schedule next %s not after %s", next, last)
+		}
+		body, err := t.body(next)
+		if err != nil {
+			return err
+		}
+		id, err := s.producer.Put(t.tube, body, t.pri, 0, t.ttr)
+		if err != nil {
+			return err
+		}
+		s.log.With("task", t.name, "tube", t.tube, "id", id, "at", next, "key", ScheduleKey(t.name, next)).Info("schedule task enqueued")
+		if err := s.store.SetLast(t.name, next); err != nil {
+			return err
+		}
+		last = next
+	}
+	return nil
+}
+
+type scheduleEntry struct {
+	last       time.Time
+	owner      string
+	leaseUntil time.Time
+}
+
+// MemoryScheduleStore 进程内的 ScheduleStore, 只适用于单实例
+type MemoryScheduleStore struct {
+	mu      sync.Mutex
+	entries map[string]*scheduleEntry
+}
+
+func NewMemoryScheduleStore() *MemoryScheduleStore {
+	return &MemoryScheduleStore{entries: map[string]*scheduleEntry{}}
+}
+
+func (m *MemoryScheduleStore) entry(name string) *scheduleEntry {
+	e, ok := m.entries[name]
+	if !ok {
+		e = &scheduleEntry{}
+		m.entries[name] = e
+	}
+	return e
+}
+
+func (m *MemoryScheduleStore) Acquire(name, owner string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.entry(name)
+	now := time.Now()
+	if e.owner != owner && e.leaseUntil.After(now) {
+		return false, nil
+	}
+	e.owner = owner
+	e.leaseUntil = now.Add(ttl)
+	return true, nil
+}
+
+func (m *MemoryScheduleStore) Last(name string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.entry(name).last, nil
+}
+
+func (m *MemoryScheduleStore) SetLast(name string, t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entry(name).last = t
+	return nil
+}
+
+// SQLScheduleStore 基于数据库表的 ScheduleStore, 可在多个实例间共享, 表结构:
+//
+//	CREATE TABLE mq_schedule (
+//	    name        VARCHAR(200) PRIMARY KEY,
+//	    last_run    BIGINT NOT NULL,
+//	    lease_owner VARCHAR(200) NOT NULL,
+//	    lease_until BIGINT NOT NULL
+//	);
+//
+// last_run/lease_until 为毫秒时间戳
+type SQLScheduleStore struct {
+	db          *sql.DB
+	table       string
+	placeholder Placeholder
+}
+
+func NewSQLScheduleStore(db *sql.DB, table string, placeholder Placeholder) *SQLScheduleStore {
+	return &SQLScheduleStore{db: db, table: table, placeholder: placeholder}
+}
+
+func (s *SQLScheduleStore) Acquire(name, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	p := s.placeholder
+	query := fmt.Sprintf(
+		"UPDATE %s SET lease_owner = %s, lease_until = %s WHERE name = %s AND (lease_owner = %s OR lease_until < %s)",
+		s.table, p(1), p(2), p(3), p(4), p(5),
+	)
+	res, err := s.db.Exec(query, owner, now.Add(ttl).UnixMilli(), name, owner, now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return n > 0, err
+	}
+	var exists int
+	err = s.db.QueryRow(fmt.Sprintf("SELECT 1 FROM %s WHERE name = %s", s.table, p(1)), name).Scan(&exists)
+	if err == nil {
+		// 租约由其他实例持有
+		return false, nil
+	} else if err != sql.ErrNoRows {
+		return false, err
+	}
+	query = fmt.Sprintf(
+		"INSERT INTO %s (name, last_run, lease_owner, lease_until) VALUES (%s, 0, %s, %s)",
+		s.table, p(1), p(2), p(3),
+	)
+	if _, err := s.db.Exec(query, name, owner, now.Add(ttl).UnixMilli()); err != nil {
+		// 插入失败后记录已存在说明其他实例同时插入, 否则返回原错误
+		if s.db.QueryRow(fmt.Sprintf("SELECT 1 FROM %s WHERE name = %s", s.table, p(1)), name).Scan(&exists) == nil {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SQLScheduleStore) Last(name string) (time.Time, error) {
+	var last int64
+	err := s.db.QueryRow(fmt.Sprintf("SELECT last_run FROM %s WHERE name = %s", s.table, s.placeholder(1)), name).Scan(&last)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	} else if last == 0 {
+		return time.Time{}, nil
+	}
+	return time.UnixMilli(last), nil
+}
+
+func (s *SQLScheduleStore) SetLast(name string, t time.Time) error {
+	query := fmt.Sprintf("UPDATE %s SET last_run = %s WHERE name = %s", s.table, s.placeholder(1), s.placeholder(2))
+	_, err := s.db.Exec(query, t.UnixMilli(), name)
+	return err
+}
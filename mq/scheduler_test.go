@@ -0,0 +1,140 @@
+package mq
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	base := time.Date(2024, 1, 31, 10, 17, 30, 0, time.UTC)
+	for expr, want := range map[string]time.Time{
+		"*/15 * * * *":    time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC),
+		"0 * * * *":       time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC),
+		"@daily":          time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		"30 2 29 feb *":   time.Date(2024, 2, 29, 2, 30, 0, 0, time.UTC),
+		"0 9 * * mon-fri": time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC),
+		"0 0 1 * 0":       time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		"@every 90s":      base.Add(90 * time.Second),
+	} {
+		s, err := ParseCron(expr)
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		if next := s.Next(base); !next.Equal(want) {
+			t.Fatalf("%s: expect %s, got %s", expr, want, next)
+		}
+	}
+	for _, expr := range []string{"* * * *", "60 * * * *", "5-1 * * * *", "*/0 * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Fatalf("%s: expect error", expr)
+		}
+	}
+}
+
+func TestScheduler_Tick(t *testing.T) {
+	m := NewMemory()
+	store := NewMemoryScheduleStore()
+	s := NewScheduler(NewProducer(m.Dial, "test", nil), store, nil)
+	s.Add("report", Every(time.Minute), "a", []byte("run"), 0, time.Minute)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Tick(start)
+	s.Tick(start.Add(3*time.Minute + time.Second))
+	if stats, _ := m.TubeStats("a"); stats.Ready != 3 {
+		t.Fatalf("expect 3 runs, got %d", stats.Ready)
+	}
+
+	// 另一个实例在租约有效期内不会投递, 租约过期后从上次投递时间继续
+	other := NewScheduler(NewProducer(m.Dial, "test", nil), store, nil)
+	other.Add("report", Every(time.Minute), "a", []byte("run"), 0, time.Minute)
+	other.Tick(start.Add(4*time.Minute + time.Second))
+	if stats, _ := m.TubeStats("a"); stats.Ready != 3 {
+		t.Fatalf("expect lease to block other scheduler, got %d", stats.Ready)
+	}
+	store.entry("report").leaseUntil = time.Time{}
+	other.Tick(start.Add(4*time.Minute + time.Second))
+	if stats, _ := m.TubeStats("a"); stats.Ready != 4 {
+		t.Fatalf("expect 4 runs, got %d", stats.Ready)
+	}
+}
+
+type fixedSchedule time.Time
+
+func (f fixedSchedule) Next(time.Time) time.Time { return time.Time(f) }
+
+func TestScheduler_NotAdvance(t *testing.T) {
+	m := NewMemory()
+	store := NewMemoryScheduleStore()
+	s := NewScheduler(NewProducer(m.Dial, "test", nil), store, nil)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Add("stuck", fixedSchedule(start), "a", []byte("run"), 0, time.Minute)
+	s.Tick(start)
+	s.Tick(start.Add(time.Minute))
+	if stats, _ := m.TubeStats("a"); stats.Ready != 0 {
+		t.Fatalf("expect no runs, got %d", stats.Ready)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expect Every(0) to panic")
+		}
+	}()
+	Every(0)
+}
+
+func TestScheduler_CatchUp(t *testing.T) {
+	m := NewMemory()
+	s := NewScheduler(NewProducer(m.Dial, "test", nil), NewMemoryScheduleStore(), nil)
+	s.Add("report", Every(time.Minute), "a", []byte("run"), 0, time.Minute)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Tick(start)
+	now := start.Add(150 * time.Minute)
+	s.Tick(now)
+	if stats, _ := m.TubeStats("a"); stats.Ready != maxCatchUp {
+		t.Fatalf("expect %d runs, got %d", maxCatchUp, stats.Ready)
+	}
+	s.Tick(now)
+	if stats, _ := m.TubeStats("a"); stats.Ready != 150 {
+		t.Fatalf("expect 150 runs, got %d", stats.Ready)
+	}
+}
+
+// failStore SetLast 失败一次, 模拟投递后记录时间前退出
+type failStore struct {
+	*MemoryScheduleStore
+	fail bool
+}
+
+func (f *failStore) SetLast(name string, t time.Time) error {
+	if f.fail {
+		f.fail = false
+		return errors.New("set last failed")
+	}
+	return f.MemoryScheduleStore.SetLast(name, t)
+}
+
+func TestScheduler_AddJSON(t *testing.T) {
+	m := NewMemory()
+	store := &failStore{MemoryScheduleStore: NewMemoryScheduleStore()}
+	s := NewScheduler(NewProducer(m.Dial, "test", nil), store, nil)
+	s.AddJSON("report", Every(time.Minute), "a", func(at time.Time) (interface{}, error) {
+		return map[string]int64{"at": at.Unix()}, nil
+	}, 0, time.Minute)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Tick(start)
+	store.fail = true
+	s.Tick(start.Add(time.Minute))
+	s.Tick(start.Add(time.Minute))
+	var keys []string
+	for i := 0; i < 2; i++ {
+		job, err := m.Reserve(0, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, EnvelopeKey(&Item{Body: job.Body}))
+	}
+	want := ScheduleKey("report", start.Add(time.Minute))
+	if keys[0] != want || keys[1] != want {
+		t.Fatalf("expect duplicate runs keyed %s, got %v", want, keys)
+	}
+}